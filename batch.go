@@ -0,0 +1,87 @@
+package gokv
+
+import "time"
+
+// BatchStorer is a Storer that can operate on many keys at once.
+// Implementations should use as few round trips (or lock acquisitions)
+// as their backend allows.
+type BatchStorer interface {
+	Storer
+	// SetMulti stores all key-value pairs of m.
+	// Every key expires after expires, 0 means never expire.
+	// No key may be "" and no value may be nil.
+	SetMulti(m map[string]interface{}, expires time.Duration) error
+	// GetMulti retrieves the values for the given keys.
+	// newValue is called once per found key and must return a pointer
+	// that the stored value is unmarshalled into.
+	// The returned map only contains the keys that were found,
+	// each mapped to the pointer returned by newValue.
+	GetMulti(keys []string, newValue func() interface{}) (map[string]interface{}, error)
+	// DeleteMulti deletes the stored values for the given keys.
+	// Deleting non-existing key-value pairs does NOT lead to an error.
+	DeleteMulti(keys []string) error
+	// HasMulti reports for each of the given keys whether a value is stored for it,
+	// without retrieving the values. Expired values don't count.
+	// The returned map contains all given keys.
+	HasMulti(keys []string) (map[string]bool, error)
+}
+
+// WithBatch returns s as a BatchStorer.
+// If s already implements BatchStorer it is returned as is,
+// otherwise it is wrapped so that each batch call is executed
+// as a sequence of single-key calls on s.
+func WithBatch(s Storer) BatchStorer {
+	if bs, ok := s.(BatchStorer); ok {
+		return bs
+	}
+	return batchStorer{s}
+}
+
+// batchStorer adapts a plain Storer to BatchStorer.
+type batchStorer struct {
+	Storer
+}
+
+func (s batchStorer) SetMulti(m map[string]interface{}, expires time.Duration) error {
+	for k, v := range m {
+		if err := s.SetEx(k, v, expires); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s batchStorer) GetMulti(keys []string, newValue func() interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(keys))
+	for _, k := range keys {
+		v := newValue()
+		found, err := s.Get(k, v)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			result[k] = v
+		}
+	}
+	return result, nil
+}
+
+func (s batchStorer) HasMulti(keys []string) (map[string]bool, error) {
+	result := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if k == "" {
+			return nil, ErrEmptyKey
+		}
+		result[k] = s.Has(k)
+	}
+	return result, nil
+}
+
+func (s batchStorer) DeleteMulti(keys []string) error {
+	for _, k := range keys {
+		if err := s.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package gokv
+
+import "time"
+
+// CASStorer is implemented by stores that can set keys conditionally and atomically,
+// for example to implement locks, leader election or idempotency keys.
+type CASStorer interface {
+	// SetNX stores v for k only if k doesn't exist or is expired.
+	// k expires after expires, 0 means never expire.
+	// It reports whether v was stored.
+	SetNX(k string, v interface{}, expires time.Duration) (stored bool, err error)
+	// CompareAndSwap stores new for k only if the stored value of k is equal to old.
+	// The values are compared by their encoded bytes, so they must encode
+	// deterministically with the store's codec.
+	// The expiry of k is kept. A missing or expired key is never swapped.
+	// It reports whether new was stored.
+	CompareAndSwap(k string, old, new interface{}) (swapped bool, err error)
+}
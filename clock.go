@@ -0,0 +1,18 @@
+package gokv
+
+import "time"
+
+// Clock tells the current time.
+// Stores that depend on the local time take one in their options, so that tests can control it.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the Clock of the local system.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,77 @@
+package gokv
+
+import (
+	"context"
+	"time"
+)
+
+// StorerContext is a Storer whose operations also accept a context.Context.
+// Implementations must return ctx.Err() instead of performing the operation
+// when the context is already done, and should pass the context on to the
+// underlying driver so that a slow call can be cancelled.
+type StorerContext interface {
+	Storer
+	// SetCtx is like Set, but aborts when ctx is done.
+	SetCtx(ctx context.Context, k string, v interface{}) error
+	// SetExCtx is like SetEx, but aborts when ctx is done.
+	SetExCtx(ctx context.Context, k string, v interface{}, expires time.Duration) error
+	// GetCtx is like Get, but aborts when ctx is done.
+	GetCtx(ctx context.Context, k string, v interface{}) (found bool, err error)
+	// HasCtx is like Has, but aborts when ctx is done.
+	// A cancelled context is reported as false.
+	HasCtx(ctx context.Context, k string) bool
+	// DeleteCtx is like Delete, but aborts when ctx is done.
+	DeleteCtx(ctx context.Context, k string) error
+}
+
+// WithContext returns s as a StorerContext.
+// If s already implements StorerContext it is returned as is,
+// otherwise it is wrapped so that each call checks the context
+// before delegating to the context-free method of s.
+// Note that a wrapped store can't abort a call that is already in progress.
+func WithContext(s Storer) StorerContext {
+	if sc, ok := s.(StorerContext); ok {
+		return sc
+	}
+	return contextStorer{s}
+}
+
+// contextStorer adapts a plain Storer to StorerContext.
+type contextStorer struct {
+	Storer
+}
+
+func (s contextStorer) SetCtx(ctx context.Context, k string, v interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.Set(k, v)
+}
+
+func (s contextStorer) SetExCtx(ctx context.Context, k string, v interface{}, expires time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.SetEx(k, v, expires)
+}
+
+func (s contextStorer) GetCtx(ctx context.Context, k string, v interface{}) (found bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return s.Get(k, v)
+}
+
+func (s contextStorer) HasCtx(ctx context.Context, k string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	return s.Has(k)
+}
+
+func (s contextStorer) DeleteCtx(ctx context.Context, k string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.Delete(k)
+}
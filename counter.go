@@ -0,0 +1,15 @@
+package gokv
+
+import "time"
+
+// Counter is implemented by stores that can atomically add to integer values,
+// for example for rate limits or page view tallies.
+// Counters are stored like any other int64 value,
+// so they can be read with Get using the store's codec.
+type Counter interface {
+	// Incr adds delta (which may be negative) to the integer stored for k
+	// and returns the new value. A missing or expired k starts at 0.
+	// If ttl > 0 the expiry of k is set to ttl on every call,
+	// otherwise the current expiry is kept and a new counter never expires.
+	Incr(k string, delta int64, ttl time.Duration) (int64, error)
+}
@@ -0,0 +1,42 @@
+package gokv
+
+import "errors"
+
+// Sentinel errors returned by all stores.
+// Errors are usually wrapped, so compare them with errors.Is.
+var (
+	// ErrEmptyKey is returned when the passed key is "".
+	ErrEmptyKey = errors.New("gokv: the passed key is an empty string, which is invalid")
+	// ErrKeyTooLong is returned when the passed key is longer than the store supports.
+	ErrKeyTooLong = errors.New("gokv: the passed key is too long for the store")
+	// ErrNilValue is returned when the passed value is nil.
+	ErrNilValue = errors.New("gokv: the passed value is nil, which is not allowed")
+	// ErrInvalidExpiry is returned when an expiry that must be positive isn't.
+	ErrInvalidExpiry = errors.New("gokv: the passed expiry is not positive, which is invalid")
+	// ErrClosed is returned when a store is used after Close was called.
+	ErrClosed = errors.New("gokv: the store is closed")
+	// ErrCodec is returned when a value can't be marshalled or unmarshalled.
+	ErrCodec = errors.New("gokv: codec failure")
+	// ErrBackendUnavailable is returned when the backend can't be reached,
+	// e.g. because of a network error or a timeout.
+	ErrBackendUnavailable = errors.New("gokv: backend unavailable")
+	// ErrBackend is returned when the backend was reached but failed to execute an operation.
+	ErrBackend = errors.New("gokv: backend failure")
+)
+
+// Error is a store failure of a certain kind.
+// errors.Is matches both its Kind, which is one of the sentinel errors,
+// and the underlying error returned by the driver, codec or operating system.
+type Error struct {
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the kind and the underlying error.
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
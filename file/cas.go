@@ -0,0 +1,120 @@
+package file
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/yifeng01/gokv/util"
+)
+
+// SetNX stores v for k only if k doesn't exist or is expired.
+// The check and the write happen under the key's file lock.
+// It reports whether v was stored.
+func (s *Store) SetNX(k string, v interface{}, expires time.Duration) (stored bool, err error) {
+	if err := util.CheckKeyAndValue(k, v); err != nil {
+		return false, err
+	}
+
+	var expiresAt time.Time
+	if expires != 0 {
+		expiresAt = time.Now().Add(expires)
+	}
+	value, err := s.encodeFile(v, expiresAt)
+	if err != nil {
+		return false, err
+	}
+
+	escapedKey := url.PathEscape(k)
+	lock, err := s.prepFileLock(escapedKey)
+	if err != nil {
+		return false, err
+	}
+	filePath := s.filePath(escapedKey)
+
+	lock.Lock()
+	defer lock.Unlock()
+	data, err := ioutil.ReadFile(filePath)
+	if err == nil {
+		current, _, err := s.parseFile(data)
+		if err != nil {
+			return false, err
+		}
+		if !current.IsExpired() {
+			return false, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return false, wrapErr(err)
+	}
+
+	return true, wrapErr(ioutil.WriteFile(filePath, value, 0600))
+}
+
+// CompareAndSwap stores new for k only if the stored value of k encodes to the same bytes as old.
+// The check and the write happen under the key's file lock.
+// The expiry of k is kept.
+// It reports whether new was stored.
+func (s *Store) CompareAndSwap(k string, old, new interface{}) (swapped bool, err error) {
+	if err := util.CheckKeyAndValue(k, old); err != nil {
+		return false, err
+	}
+	if err := util.CheckVal(new); err != nil {
+		return false, err
+	}
+
+	oldValue, err := s.marshal(old)
+	if err != nil {
+		return false, err
+	}
+
+	escapedKey := url.PathEscape(k)
+	lock, err := s.prepFileLock(escapedKey)
+	if err != nil {
+		return false, err
+	}
+	filePath := s.filePath(escapedKey)
+
+	lock.Lock()
+	defer lock.Unlock()
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, wrapErr(err)
+	}
+	h, payload, err := s.parseFile(data)
+	if err != nil || h.IsExpired() {
+		return false, err
+	}
+
+	current, err := s.encodedValue(h, payload, old)
+	if err != nil || !bytes.Equal(current, oldValue) {
+		return false, err
+	}
+
+	// The file is written in the configured format, whatever format it had.
+	data, err = s.encodeFile(new, h.ExpiresAt)
+	if err != nil {
+		return false, err
+	}
+	return true, wrapErr(ioutil.WriteFile(filePath, data, 0600))
+}
+
+// encodedValue returns the encoded value of a file's payload.
+// The value in the payload of an older version is wrapped in an Item,
+// so it is decoded into a value of the same type as hint and encoded again.
+func (s *Store) encodedValue(h header, payload []byte, hint interface{}) ([]byte, error) {
+	if !h.legacy {
+		return payload, nil
+	}
+
+	v := reflect.New(reflect.TypeOf(hint))
+	if err := s.decodeValue(h, payload, v.Interface()); err != nil {
+		return nil, err
+	}
+	return s.marshal(v.Elem().Interface())
+}
@@ -0,0 +1,57 @@
+package file
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/yifeng01/gokv/util"
+)
+
+// Incr adds delta to the integer stored for k under the key's file lock and returns the new value.
+// A missing or expired k starts at 0.
+// If ttl > 0 the expiry of k is set to ttl, otherwise the current expiry is kept.
+func (s *Store) Incr(k string, delta int64, ttl time.Duration) (int64, error) {
+	if err := util.CheckKey(k); err != nil {
+		return 0, err
+	}
+
+	escapedKey := url.PathEscape(k)
+	lock, err := s.prepFileLock(escapedKey)
+	if err != nil {
+		return 0, err
+	}
+	filePath := s.filePath(escapedKey)
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	var n int64
+	var expiresAt time.Time
+	data, err := ioutil.ReadFile(filePath)
+	if err == nil {
+		current, payload, err := s.parseFile(data)
+		if err != nil {
+			return 0, err
+		}
+		if !current.IsExpired() {
+			if err := s.decodeValue(current, payload, &n); err != nil {
+				return 0, err
+			}
+			expiresAt = current.ExpiresAt
+		}
+	} else if !os.IsNotExist(err) {
+		return 0, wrapErr(err)
+	}
+	n += delta
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	data, err = s.encodeFile(n, expiresAt)
+	if err != nil {
+		return 0, err
+	}
+	return n, wrapErr(ioutil.WriteFile(filePath, data, 0600))
+}
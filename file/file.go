@@ -1,20 +1,28 @@
 package file
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 	"io/ioutil"
-	"log"
 	"net/url"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 
+	"github.com/yifeng01/gokv"
 	"github.com/yifeng01/gokv/encoding"
 	"github.com/yifeng01/gokv/util"
 )
 
 var defaultFilenameExtension = "json"
 
+// _pingFilePrefix is the filename prefix of the files written by Ping.
+// It can't be un-escaped, so the files are never taken for stored values.
+const _pingFilePrefix = "%gokv-ping-"
+
 // Store is a gokv.Store implementation for storing key-value pairs as files.
 type Store struct {
 	// For locking the locks map
@@ -25,6 +33,12 @@ type Store struct {
 	filenameExtension string
 	directory         string
 	codec             encoding.Codec
+	expiryHeader      bool
+	logger            gokv.Logger
+	// For stopping the auto GC, nil if it's disabled.
+	gcStop chan struct{}
+	gcDone chan struct{}
+	gcOnce *sync.Once
 }
 
 // Set stores the given value for the given key.
@@ -36,23 +50,26 @@ func (s *Store) Set(k string, v interface{}) error {
 
 // SetEx store the give value for the given key and the key expire after expires.
 func (s *Store) SetEx(k string, v interface{}, expires time.Duration) error {
+	return s.SetExCtx(context.Background(), k, v, expires)
+}
+
+// SetCtx is like Set, but aborts when ctx is done.
+func (s *Store) SetCtx(ctx context.Context, k string, v interface{}) error {
+	return s.SetExCtx(ctx, k, v, 0)
+}
+
+// SetExCtx is like SetEx, but aborts when ctx is done.
+func (s *Store) SetExCtx(ctx context.Context, k string, v interface{}, expires time.Duration) error {
 	if err := util.CheckKeyAndValue(k, v); err != nil {
 		return err
 	}
 
-	var item *Item
-	if expires == 0 {
-		item = &Item{
-			Data: v,
-		}
-	} else {
-		item = &Item{
-			ExpiresAt: time.Now().Add(expires),
-			Data:      v,
-		}
+	var expiresAt time.Time
+	if expires != 0 {
+		expiresAt = time.Now().Add(expires)
 	}
 
-	data, err := s.codec.Marshal(item)
+	data, err := s.encodeFile(v, expiresAt)
 	if err != nil {
 		return err
 	}
@@ -60,27 +77,36 @@ func (s *Store) SetEx(k string, v interface{}, expires time.Duration) error {
 	escapedKey := url.PathEscape(k)
 
 	// Prepare file lock.
-	lock := s.prepFileLock(escapedKey)
+	lock, err := s.prepFileLock(escapedKey)
+	if err != nil {
+		return err
+	}
 
-	filename := escapedKey
-	if s.filenameExtension != "" {
-		filename += "." + s.filenameExtension
+	filePath := s.filePath(escapedKey)
+
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-	filePath := filepath.Clean(s.directory + "/" + filename)
 
 	// File lock and file handling.
 	lock.Lock()
 	defer lock.Unlock()
-	return ioutil.WriteFile(filePath, data, 0600)
+	return wrapErr(ioutil.WriteFile(filePath, data, 0600))
 }
 
 // Get retrieves the stored value for the given key.
+// Expired values are reported as not found and their files are deleted.
 // You need to pass a pointer to the value, so in case of a struct
 // the automatic unmarshalling can populate the fields of the object
 // that v points to with the values of the retrieved object's values.
 // If no value is found it returns (false, nil).
 // The key must not be "" and the pointer must not be nil.
 func (s *Store) Get(k string, v interface{}) (found bool, err error) {
+	return s.GetCtx(context.Background(), k, v)
+}
+
+// GetCtx is like Get, but aborts when ctx is done.
+func (s *Store) GetCtx(ctx context.Context, k string, v interface{}) (found bool, err error) {
 	if err := util.CheckKeyAndValue(k, v); err != nil {
 		return false, err
 	}
@@ -88,13 +114,16 @@ func (s *Store) Get(k string, v interface{}) (found bool, err error) {
 	escapedKey := url.PathEscape(k)
 
 	// Prepare file lock.
-	lock := s.prepFileLock(escapedKey)
+	lock, err := s.prepFileLock(escapedKey)
+	if err != nil {
+		return false, err
+	}
 
-	filename := escapedKey
-	if s.filenameExtension != "" {
-		filename += "." + s.filenameExtension
+	filePath := s.filePath(escapedKey)
+
+	if err := ctx.Err(); err != nil {
+		return false, err
 	}
-	filePath := filepath.Clean(s.directory + "/" + filename)
 
 	// File lock and file handling.
 	lock.RLock()
@@ -105,40 +134,48 @@ func (s *Store) Get(k string, v interface{}) (found bool, err error) {
 		if os.IsNotExist(err) {
 			return false, nil
 		}
-		return false, err
+		return false, wrapErr(err)
 	}
 
-	item := &Item{Data: v}
-	if err := s.codec.Unmarshal(data, item); err != nil {
+	h, payload, err := s.parseFile(data)
+	if err != nil {
+		return false, err
+	}
+	if h.IsExpired() {
+		_, err := s.removeExpired(escapedKey)
+		return false, err
+	}
+	if err := s.decodeValue(h, payload, v); err != nil {
 		return false, err
 	}
 
 	return true, nil
 }
 
-// Has judge store has a key for k
+// Has judge store has a key for k that isn't expired
 func (s *Store) Has(k string) bool {
+	return s.HasCtx(context.Background(), k)
+}
+
+// HasCtx is like Has, but returns false when ctx is done.
+func (s *Store) HasCtx(ctx context.Context, k string) bool {
 	if err := util.CheckKey(k); err != nil {
 		return false
 	}
 
 	escapedKey := url.PathEscape(k)
 
-	// Prepare file lock.
-	lock := s.prepFileLock(escapedKey)
-
-	filename := escapedKey
-	if s.filenameExtension != "" {
-		filename += "." + s.filenameExtension
+	if ctx.Err() != nil {
+		return false
 	}
-	filePath := filepath.Clean(s.directory + "/" + filename)
 
-	// File lock and file handling.
-	lock.RLock()
-	// Deferring the unlocking would lead to the unmarshalling being done during the lock, which is bad for performance.
-	_, err := ioutil.ReadFile(filePath)
-	lock.RUnlock()
-	if err != nil {
+	// Only the header with the expiry is read, not the value.
+	h, found, err := s.readHeader(escapedKey)
+	if err != nil || !found {
+		return false
+	}
+	if h.IsExpired() {
+		s.removeExpired(escapedKey)
 		return false
 	}
 
@@ -149,6 +186,11 @@ func (s *Store) Has(k string) bool {
 // Deleting a non-existing key-value pair does NOT lead to an error.
 // The key must not be "".
 func (s *Store) Delete(k string) error {
+	return s.DeleteCtx(context.Background(), k)
+}
+
+// DeleteCtx is like Delete, but aborts when ctx is done.
+func (s *Store) DeleteCtx(ctx context.Context, k string) error {
 	if err := util.CheckKey(k); err != nil {
 		return err
 	}
@@ -156,72 +198,109 @@ func (s *Store) Delete(k string) error {
 	escapedKey := url.PathEscape(k)
 
 	// Prepare file lock.
-	lock := s.prepFileLock(escapedKey)
+	lock, err := s.prepFileLock(escapedKey)
+	if err != nil {
+		return err
+	}
 
-	filename := escapedKey
-	if s.filenameExtension != "" {
-		filename += "." + s.filenameExtension
+	filePath := s.filePath(escapedKey)
+
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-	filePath := filepath.Clean(s.directory + "/" + filename)
 
 	// File lock and file handling.
 	lock.Lock()
 	defer lock.Unlock()
-	err := os.Remove(filePath)
+	err = os.Remove(filePath)
 	if os.IsNotExist(err) {
 		return nil
 	}
-	return err
+	return wrapErr(err)
+}
+
+// removeExpired deletes the file for escapedKey if it is expired.
+// The file is checked again under the write lock,
+// so a value that was written in the meantime isn't deleted.
+// It reports whether the file was deleted.
+func (s *Store) removeExpired(escapedKey string) (removed bool, err error) {
+	lock, err := s.prepFileLock(escapedKey)
+	if err != nil {
+		return false, err
+	}
+	filePath := s.filePath(escapedKey)
+
+	lock.Lock()
+	defer lock.Unlock()
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, wrapErr(err)
+	}
+	h, _, err := s.parseFile(data)
+	if err != nil || !h.IsExpired() {
+		return false, err
+	}
+
+	err = os.Remove(filePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, wrapErr(err)
 }
 
 // Close closes the store.
 // When called, some resources of the store are left for garbage collection.
+// The auto GC is stopped first, a running pass is waited for.
+// Using the store afterwards results in gokv.ErrClosed.
 func (s *Store) Close() error {
+	s.stopGC()
+
+	s.locksLock.Lock()
+	defer s.locksLock.Unlock()
 	s.fileLocks = nil
 	return nil
 }
 
 // GC recycle expire items
-func (s *Store) GC() {
-	log.Println("gc begin....")
-	filepath.Walk(
-		s.directory,
-		func(path string, finfo os.FileInfo, err error) error {
-			lock := s.prepFileLock(path)
-			lock.Lock()
-			defer lock.Unlock()
-
-			log.Printf("gc: check path=%s\n", path)
-
-			if err != nil {
-				return err
-			}
-
-			if finfo.IsDir() {
-				return nil
-			}
-
-			data, err := ioutil.ReadFile(path)
-			if err != nil {
-				return err
-			}
-
-			item := &Item{}
-			err = s.codec.Unmarshal(data, item)
-			if err != nil {
-				return err
-			}
-			if item.IsExpired() {
-				return os.Remove(path)
-			}
-
-			return nil
-		})
-	log.Println("gc end...")
+// Every file is checked under its file lock, so files that are written meanwhile aren't deleted.
+// A file that can't be read or decoded is logged at gokv.LevelWarn and skipped,
+// so that it doesn't keep the expired files after it on disk.
+func (s *Store) GC() (stats gokv.GCStats) {
+	start := time.Now()
+	defer func() {
+		stats.Duration = time.Since(start)
+	}()
+
+	escapedKeys, err := s.escapedKeys()
+	if err != nil {
+		stats.Err = err
+		return stats
+	}
+	for _, escapedKey := range escapedKeys {
+		stats.Scanned++
+		removed, err := s.removeExpired(escapedKey)
+		if errors.Is(err, gokv.ErrClosed) {
+			stats.Err = err
+			return stats
+		}
+		if err != nil {
+			s.logger.Log(gokv.LevelWarn, "file: gc skipped a file that can't be read", "file", s.filePath(escapedKey), "err", err)
+			continue
+		}
+		if removed {
+			stats.Removed++
+		}
+	}
+	return stats
 }
 
 // auto GC
-func (s *Store) autoGC(interval time.Duration) {
+// It runs until stopGC is called, onGC (if not nil) gets the results of every pass.
+func (s *Store) autoGC(interval time.Duration, onGC func(gokv.GCStats)) {
+	defer close(s.gcDone)
 	if interval == 0 {
 		interval = 30 * time.Second
 	}
@@ -230,21 +309,73 @@ func (s *Store) autoGC(interval time.Duration) {
 	defer tk.Stop()
 
 	for {
-		<-tk.C
-		s.GC()
+		select {
+		case <-s.gcStop:
+			return
+		case <-tk.C:
+			stats := s.GC()
+			util.LogGC(s.logger, "file", stats)
+			if onGC != nil {
+				onGC(stats)
+			}
+		}
 	}
 }
 
-// prepFileLock returns an existing file lock or creates a new one
-func (s *Store) prepFileLock(escapedKey string) *sync.RWMutex {
+// stopGC stops the auto GC and waits until it has returned.
+func (s *Store) stopGC() {
+	if s.gcStop == nil {
+		return
+	}
+	s.gcOnce.Do(func() {
+		close(s.gcStop)
+	})
+	<-s.gcDone
+}
+
+// filePath returns the path of the file that holds the value for escapedKey.
+func (s *Store) filePath(escapedKey string) string {
+	filename := escapedKey
+	if s.filenameExtension != "" {
+		filename += "." + s.filenameExtension
+	}
+	return filepath.Clean(s.directory + "/" + filename)
+}
+
+// prepFileLock returns an existing file lock or creates a new one.
+// It returns gokv.ErrClosed if the store was closed.
+func (s *Store) prepFileLock(escapedKey string) (*sync.RWMutex, error) {
 	s.locksLock.Lock()
+	defer s.locksLock.Unlock()
+	if s.fileLocks == nil {
+		return nil, gokv.ErrClosed
+	}
 	lock, found := s.fileLocks[escapedKey]
 	if !found {
 		lock = new(sync.RWMutex)
 		s.fileLocks[escapedKey] = lock
 	}
-	s.locksLock.Unlock()
-	return lock
+	return lock, nil
+}
+
+// marshal encodes v with the store's codec.
+func (s *Store) marshal(v interface{}) ([]byte, error) {
+	data, err := s.codec.Marshal(v)
+	return data, util.WrapError(gokv.ErrCodec, err)
+}
+
+// unmarshal decodes data into v with the store's codec.
+func (s *Store) unmarshal(data []byte, v interface{}) error {
+	return util.WrapError(gokv.ErrCodec, s.codec.Unmarshal(data, v))
+}
+
+// wrapErr maps file system errors onto the gokv errors.
+// A missing or inaccessible directory makes the store unavailable.
+func wrapErr(err error) error {
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+		return util.WrapError(gokv.ErrBackendUnavailable, err)
+	}
+	return util.WrapError(gokv.ErrBackend, err)
 }
 
 // Options are the options for the Go file store.
@@ -265,8 +396,29 @@ type Options struct {
 	// Note: When you change this, you should also change the FilenameExtension if it's not empty ("").
 	// Optional (encoding.JSON by default).
 	Codec encoding.Codec
+	// ExpiryHeader makes the store write a header line with the expiry in front of the encoded value,
+	// instead of encoding the value together with its expiry in an Item.
+	// TTL, Has, Expire, Persist and GC then don't need to decode or re-encode values,
+	// but the files aren't valid JSON (or gob) anymore and can't be read by versions without this option.
+	// Files of both formats are always readable, see the README for switching it on and off.
+	// Optional (false by default).
+	ExpiryHeader bool
 
 	Interval time.Duration
+	// DisableAutoGC turns off the periodic removal of expired files.
+	// Expired values are still never returned, and GC can be called manually.
+	// Optional (false by default).
+	DisableAutoGC bool
+	// OnGC is called with the results of every auto GC pass.
+	// Optional (nil by default).
+	OnGC func(gokv.GCStats)
+	// Logger receives the store's log messages, e.g. the results of the auto GC passes.
+	// Optional (gokv.NopLogger by default).
+	Logger gokv.Logger
+	// HealthCheck makes NewE write and delete a file in the directory,
+	// so that a directory that isn't writable is reported right away instead of by the first Set.
+	// Optional (false by default).
+	HealthCheck bool
 }
 
 // DefaultOptions is an Options object with default values.
@@ -279,9 +431,19 @@ var DefaultOptions = Options{
 }
 
 // New creates a new Go file store.
+// It returns nil if the directory can't be created, use NewE to get the cause.
 //
 // You should call the Close() method on the store when you're done working with it.
 func New(options Options) *Store {
+	s, err := NewE(options)
+	if err != nil {
+		return nil
+	}
+	return s
+}
+
+// NewE is like New, but returns the error that prevented the store from being created.
+func NewE(options Options) (*Store, error) {
 	// Set default options
 	if options.Directory == "" {
 		options.Directory = DefaultOptions.Directory
@@ -292,10 +454,13 @@ func New(options Options) *Store {
 	if options.Codec == nil {
 		options.Codec = DefaultOptions.Codec
 	}
+	if options.Logger == nil {
+		options.Logger = gokv.NopLogger
+	}
 
 	err := os.MkdirAll(options.Directory, 0700)
 	if err != nil {
-		return nil
+		return nil, fmt.Errorf("file: can't create directory %s: %w", options.Directory, wrapErr(err))
 	}
 
 	result := Store{
@@ -304,14 +469,38 @@ func New(options Options) *Store {
 		fileLocks:         make(map[string]*sync.RWMutex),
 		filenameExtension: *options.FilenameExtension,
 		codec:             options.Codec,
+		expiryHeader:      options.ExpiryHeader,
+		logger:            options.Logger,
 	}
 
-	go result.autoGC(options.Interval)
+	if options.HealthCheck {
+		if err := result.Ping(); err != nil {
+			return nil, fmt.Errorf("file: health check of directory %s failed: %w", options.Directory, err)
+		}
+	}
+
+	if !options.DisableAutoGC {
+		result.gcStop = make(chan struct{})
+		result.gcDone = make(chan struct{})
+		result.gcOnce = new(sync.Once)
+		go result.autoGC(options.Interval, options.OnGC)
+	}
 
-	return &result
+	return &result, nil
+}
+
+// Ping checks that files can be written to and deleted from the store's directory.
+func (s *Store) Ping() error {
+	f, err := ioutil.TempFile(s.directory, _pingFilePrefix+"*")
+	if err != nil {
+		return wrapErr(err)
+	}
+	f.Close()
+	return wrapErr(os.Remove(f.Name()))
 }
 
-//Item identifes a cached piece of data
+//Item identifes a cached piece of data.
+//It is the file format of older versions of the store, which is still readable.
 type Item struct {
 	ExpiresAt time.Time
 	Data      interface{}
@@ -0,0 +1,231 @@
+package file
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/yifeng01/gokv/encoding"
+)
+
+// By default files contain the codec output of an Item, which holds the expiry and the value,
+// so they stay valid JSON (or gob) and readable by older versions.
+//
+// With Options.ExpiryHeader files start with a fixed-size header line holding the expiry,
+// followed by the codec output of the value:
+//
+//	gokv1 00000000000000000000\n<value>
+//
+// The expiry is stored in Unix nanoseconds, 0 means never expire.
+// Keeping it out of the encoded value lets the store read and change the expiry
+// without unmarshalling or re-encoding the value.
+// When the expiry of an Item file is changed with the option on, it gets a "gokv0" header
+// in front of the unchanged Item.
+//
+// Both formats are always readable, so the option can be turned on for existing files.
+const (
+	_headerMagic       = "gokv"
+	_headerValueFormat = '1'
+	_headerItemFormat  = '0'
+	// magic, format, space, 20 digits, newline
+	_headerLen = len(_headerMagic) + 1 + 1 + 20 + 1
+)
+
+// header is the metadata stored in front of a value.
+type header struct {
+	ExpiresAt time.Time
+	// legacy is true if the payload is an encoded Item instead of an encoded value.
+	legacy bool
+	// inline is true if the file has no header line, the expiry is the one of the encoded Item.
+	inline bool
+}
+
+// IsExpired reports whether the header's expiry has passed.
+func (h header) IsExpired() bool {
+	//zero means never expire
+	if h.ExpiresAt.IsZero() {
+		return false
+	}
+	return time.Now().After(h.ExpiresAt)
+}
+
+// TTL returns the time left until the header's expiry, 0 means never expire.
+func (h header) TTL() time.Duration {
+	if h.ExpiresAt.IsZero() {
+		return 0
+	}
+	return time.Until(h.ExpiresAt)
+}
+
+// bytes returns the encoded header line.
+func (h header) bytes() []byte {
+	format := _headerValueFormat
+	if h.legacy {
+		format = _headerItemFormat
+	}
+	var nanos int64
+	if !h.ExpiresAt.IsZero() {
+		nanos = h.ExpiresAt.UnixNano()
+	}
+	return []byte(fmt.Sprintf("%s%c %020d\n", _headerMagic, format, nanos))
+}
+
+// parseHeader decodes the header line at the start of data.
+// ok is false if data doesn't start with a header.
+func parseHeader(data []byte) (h header, payload []byte, ok bool) {
+	if len(data) < _headerLen || !bytes.HasPrefix(data, []byte(_headerMagic)) || data[_headerLen-1] != '\n' {
+		return header{}, nil, false
+	}
+
+	format := data[len(_headerMagic)]
+	if format != _headerValueFormat && format != _headerItemFormat {
+		return header{}, nil, false
+	}
+	nanos, err := strconv.ParseInt(string(data[len(_headerMagic)+2:_headerLen-1]), 10, 64)
+	if err != nil {
+		return header{}, nil, false
+	}
+
+	h.legacy = format == _headerItemFormat
+	if nanos != 0 {
+		h.ExpiresAt = time.Unix(0, nanos)
+	}
+	return h, data[_headerLen:], true
+}
+
+// readFile reads the file for escapedKey and splits it into header and payload.
+// found is false if the file doesn't exist.
+func (s *Store) readFile(escapedKey string) (h header, payload []byte, found bool, err error) {
+	lock, err := s.prepFileLock(escapedKey)
+	if err != nil {
+		return header{}, nil, false, err
+	}
+	lock.RLock()
+	data, err := ioutil.ReadFile(s.filePath(escapedKey))
+	lock.RUnlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return header{}, nil, false, nil
+		}
+		return header{}, nil, false, wrapErr(err)
+	}
+
+	h, payload, err = s.parseFile(data)
+	if err != nil {
+		return header{}, nil, false, err
+	}
+	return h, payload, true, nil
+}
+
+// readHeader reads only the header of the file for escapedKey, not the value behind it.
+// Files without a header are read as a whole, their expiry is part of the encoded Item.
+// found is false if the file doesn't exist.
+func (s *Store) readHeader(escapedKey string) (h header, found bool, err error) {
+	lock, err := s.prepFileLock(escapedKey)
+	if err != nil {
+		return header{}, false, err
+	}
+	lock.RLock()
+	defer lock.RUnlock()
+
+	h, _, found, err = s.headerOf(escapedKey)
+	return h, found, err
+}
+
+// headerOf is like readHeader, but the caller must hold the file lock of escapedKey.
+// data is the content of a file without a header, which has been read as a whole, and nil otherwise.
+func (s *Store) headerOf(escapedKey string) (h header, data []byte, found bool, err error) {
+	f, err := os.Open(s.filePath(escapedKey))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return header{}, nil, false, nil
+		}
+		return header{}, nil, false, wrapErr(err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, _headerLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return header{}, nil, false, wrapErr(err)
+	}
+	if h, _, ok := parseHeader(buf[:n]); ok {
+		return h, nil, true, nil
+	}
+
+	rest, err := ioutil.ReadAll(f)
+	if err != nil {
+		return header{}, nil, false, wrapErr(err)
+	}
+	data = append(buf[:n], rest...)
+	if h, _, err = s.parseFile(data); err != nil {
+		return header{}, nil, false, err
+	}
+	return h, data, true, nil
+}
+
+// parseFile splits the content of a file into its header and payload.
+// The header of a file without one is taken from the encoded Item.
+func (s *Store) parseFile(data []byte) (header, []byte, error) {
+	if h, payload, ok := parseHeader(data); ok {
+		return h, payload, nil
+	}
+
+	// Fields that aren't part of the struct (i.e. Data) are skipped by both the JSON and the gob decoder.
+	var item struct {
+		ExpiresAt time.Time
+	}
+	if err := s.unmarshal(data, &item); err != nil {
+		return header{}, nil, err
+	}
+	return header{ExpiresAt: item.ExpiresAt, legacy: true, inline: true}, data, nil
+}
+
+// encodeFile returns the content of the file for v, which expires at expiresAt.
+// It's an encoded Item, or with Options.ExpiryHeader a header line and the encoded value.
+func (s *Store) encodeFile(v interface{}, expiresAt time.Time) ([]byte, error) {
+	if !s.expiryHeader {
+		return s.marshal(&Item{ExpiresAt: expiresAt, Data: v})
+	}
+	value, err := s.marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(header{ExpiresAt: expiresAt}.bytes(), value...), nil
+}
+
+// reencodeItem returns the encoded Item of payload with expiresAt as its expiry.
+// With the JSON codec the value is kept verbatim, other codecs decode and encode it again.
+func (s *Store) reencodeItem(payload []byte, expiresAt time.Time) ([]byte, error) {
+	if _, ok := s.codec.(encoding.JSONcodec); ok {
+		var item struct {
+			ExpiresAt time.Time
+			Data      json.RawMessage
+		}
+		if err := s.unmarshal(payload, &item); err != nil {
+			return nil, err
+		}
+		item.ExpiresAt = expiresAt
+		return s.marshal(&item)
+	}
+
+	var item Item
+	if err := s.unmarshal(payload, &item); err != nil {
+		return nil, err
+	}
+	item.ExpiresAt = expiresAt
+	return s.marshal(&item)
+}
+
+// decodeValue unmarshals the payload of a file into v.
+func (s *Store) decodeValue(h header, payload []byte, v interface{}) error {
+	if h.legacy {
+		return s.unmarshal(payload, &Item{Data: v})
+	}
+	return s.unmarshal(payload, v)
+}
@@ -0,0 +1,109 @@
+package file
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/yifeng01/gokv"
+	"github.com/yifeng01/gokv/util"
+)
+
+// Keys returns the next page of keys that start with prefix, in lexical order.
+// The keys are the un-escaped names of the files in the store's directory.
+// Pass "" as cursor to start; an empty next cursor means the iteration is complete.
+// Expired entries are skipped.
+func (s *Store) Keys(prefix, cursor string, count int) (keys []string, next string, err error) {
+	keys, err = s.liveKeys(prefix)
+	if err != nil {
+		return nil, "", err
+	}
+
+	keys, next = util.PageKeys(keys, cursor, count)
+	return keys, next, nil
+}
+
+// Entries returns the next page of key-value pairs whose keys start with prefix, in lexical key order.
+// newValue must return a pointer that a value is unmarshalled into.
+// Expired entries are skipped.
+func (s *Store) Entries(prefix, cursor string, count int, newValue func() interface{}) (entries []gokv.KeyValue, next string, err error) {
+	keys, err := s.liveKeys(prefix)
+	if err != nil {
+		return nil, "", err
+	}
+
+	keys, next = util.PageKeys(keys, cursor, count)
+	entries = make([]gokv.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		v := newValue()
+		found, err := s.Get(k, v)
+		if err != nil {
+			return nil, "", err
+		}
+		// The file might have been deleted since the directory was read.
+		if found {
+			entries = append(entries, gokv.KeyValue{Key: k, Value: v})
+		}
+	}
+	return entries, next, nil
+}
+
+// liveKeys returns the keys of all unexpired files whose keys start with prefix.
+// With Options.ExpiryHeader only the headers of the files are read, not the values.
+// A file that can't be read or decoded is logged at gokv.LevelWarn and skipped, like by GC.
+func (s *Store) liveKeys(prefix string) ([]string, error) {
+	escapedKeys, err := s.escapedKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(escapedKeys))
+	for _, escapedKey := range escapedKeys {
+		k, _ := url.PathUnescape(escapedKey)
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+
+		h, found, err := s.readHeader(escapedKey)
+		if errors.Is(err, gokv.ErrClosed) {
+			return nil, err
+		}
+		if err != nil {
+			s.logger.Log(gokv.LevelWarn, "file: scan skipped a file that can't be read", "file", s.filePath(escapedKey), "err", err)
+			continue
+		}
+		if found && !h.IsExpired() {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+// escapedKeys returns the escaped keys of all files in the store's directory.
+// Other files, like the ones with a different filename extension, are skipped.
+func (s *Store) escapedKeys() ([]string, error) {
+	finfos, err := ioutil.ReadDir(s.directory)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	suffix := ""
+	if s.filenameExtension != "" {
+		suffix = "." + s.filenameExtension
+	}
+
+	escapedKeys := make([]string, 0, len(finfos))
+	for _, finfo := range finfos {
+		if finfo.IsDir() || !strings.HasSuffix(finfo.Name(), suffix) {
+			continue
+		}
+		escapedKey := strings.TrimSuffix(finfo.Name(), suffix)
+		if _, err := url.PathUnescape(escapedKey); err != nil {
+			// Not a file written by this store.
+			continue
+		}
+		escapedKeys = append(escapedKeys, escapedKey)
+	}
+	return escapedKeys, nil
+}
@@ -0,0 +1,113 @@
+package file
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/yifeng01/gokv/util"
+)
+
+// TTL returns the time left until k expires, 0 means that k never expires.
+// With Options.ExpiryHeader only the file's header is decoded, not the value.
+func (s *Store) TTL(k string) (ttl time.Duration, found bool, err error) {
+	if err := util.CheckKey(k); err != nil {
+		return 0, false, err
+	}
+
+	h, found, err := s.readHeader(url.PathEscape(k))
+	if err != nil || !found || h.IsExpired() {
+		return 0, false, err
+	}
+
+	return h.TTL(), true, nil
+}
+
+// Expire sets k to expire after expires, which must be positive.
+// With Options.ExpiryHeader only the file's header is rewritten, the encoded value is kept as is.
+func (s *Store) Expire(k string, expires time.Duration) (found bool, err error) {
+	if err := util.CheckExpires(expires); err != nil {
+		return false, err
+	}
+	return s.setExpiresAt(k, time.Now().Add(expires))
+}
+
+// Persist removes the expiry of k, so that it never expires.
+// With Options.ExpiryHeader only the file's header is rewritten, the encoded value is kept as is.
+func (s *Store) Persist(k string) (found bool, err error) {
+	return s.setExpiresAt(k, time.Time{})
+}
+
+// Touch sets the access and modification time of the file for k to now.
+// With Options.ExpiryHeader only the file's header is read.
+func (s *Store) Touch(k string) (found bool, err error) {
+	if err := util.CheckKey(k); err != nil {
+		return false, err
+	}
+
+	escapedKey := url.PathEscape(k)
+	lock, err := s.prepFileLock(escapedKey)
+	if err != nil {
+		return false, err
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	h, _, found, err := s.headerOf(escapedKey)
+	if err != nil || !found || h.IsExpired() {
+		return false, err
+	}
+
+	now := time.Now()
+	return true, wrapErr(os.Chtimes(s.filePath(escapedKey), now, now))
+}
+
+// setExpiresAt rewrites the header of the file for k with the given expiry,
+// or the encoded Item if the file has no header and Options.ExpiryHeader is off.
+// The header has a fixed size, so it is overwritten in place and the value isn't read.
+func (s *Store) setExpiresAt(k string, expiresAt time.Time) (found bool, err error) {
+	if err := util.CheckKey(k); err != nil {
+		return false, err
+	}
+
+	escapedKey := url.PathEscape(k)
+	lock, err := s.prepFileLock(escapedKey)
+	if err != nil {
+		return false, err
+	}
+	filePath := s.filePath(escapedKey)
+
+	lock.Lock()
+	defer lock.Unlock()
+	h, data, found, err := s.headerOf(escapedKey)
+	if err != nil || !found || h.IsExpired() {
+		return false, err
+	}
+
+	h.ExpiresAt = expiresAt
+	if !h.inline {
+		return true, s.writeHeader(filePath, h)
+	}
+	if !s.expiryHeader {
+		data, err = s.reencodeItem(data, expiresAt)
+		if err != nil {
+			return false, err
+		}
+		return true, wrapErr(ioutil.WriteFile(filePath, data, 0600))
+	}
+	return true, wrapErr(ioutil.WriteFile(filePath, append(h.bytes(), data...), 0600))
+}
+
+// writeHeader overwrites the header at the start of the file at filePath with h.
+func (s *Store) writeHeader(filePath string, h header) error {
+	f, err := os.OpenFile(filePath, os.O_WRONLY, 0600)
+	if err != nil {
+		return wrapErr(err)
+	}
+	if _, err := f.WriteAt(h.bytes(), 0); err != nil {
+		f.Close()
+		return wrapErr(err)
+	}
+	return wrapErr(f.Close())
+}
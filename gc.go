@@ -0,0 +1,23 @@
+package gokv
+
+import "time"
+
+// Collector is implemented by stores that remove expired entries in garbage collection passes.
+// Stores that implement it run a pass periodically unless this is disabled in their options,
+// GC runs one pass right away.
+type Collector interface {
+	// GC removes all expired entries and returns the results of the pass.
+	GC() GCStats
+}
+
+// GCStats are the results of one garbage collection pass.
+type GCStats struct {
+	// Scanned is the number of entries that were checked.
+	Scanned int
+	// Removed is the number of expired entries that were removed.
+	Removed int
+	// Duration is how long the pass took.
+	Duration time.Duration
+	// Err is the error that ended the pass early, nil if the pass completed.
+	Err error
+}
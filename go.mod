@@ -1,12 +1,19 @@
 module github.com/yifeng01/gokv
 
-go 1.13
+go 1.20
 
 require (
 	github.com/denisenkom/go-mssqldb v0.0.0-20200910202707-1e08a3fab204
 	github.com/go-redis/redis v6.15.9+incompatible
 	github.com/go-xorm/xorm v0.7.9
+	github.com/mattn/go-sqlite3 v1.14.22
+	xorm.io/core v0.7.3
+)
+
+require (
+	github.com/golang-sql/civil v0.0.0-20190719163853-cb61b32ac6fe // indirect
 	github.com/onsi/ginkgo v1.14.1 // indirect
 	github.com/onsi/gomega v1.10.2 // indirect
-	xorm.io/core v0.7.3
+	golang.org/x/crypto v0.0.0-20190325154230-a5d413f7728c // indirect
+	xorm.io/builder v0.3.6 // indirect
 )
@@ -0,0 +1,132 @@
+package gomap
+
+import (
+	"time"
+
+	"github.com/yifeng01/gokv"
+	"github.com/yifeng01/gokv/util"
+)
+
+// SetMulti stores all key-value pairs of m, taking the lock only once.
+// Every key expires after expires, 0 means never expire.
+// No key may be "" and no value may be nil.
+func (s *Store) SetMulti(m map[string]interface{}, expires time.Duration) error {
+	items := make(map[string]*Item, len(m))
+	for k, v := range m {
+		if err := util.CheckKeyAndValue(k, v); err != nil {
+			return err
+		}
+		data, err := s.marshal(v)
+		if err != nil {
+			return err
+		}
+		items[k] = newItem(data, expires)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.m == nil {
+		return gokv.ErrClosed
+	}
+	for k, item := range items {
+		s.m[k] = item
+	}
+	return nil
+}
+
+// GetMulti retrieves the values for the given keys, taking the read lock only once.
+// Expired values are reported as not found and deleted.
+// newValue must return a pointer that a found value is unmarshalled into.
+// The returned map only contains the keys that were found.
+func (s *Store) GetMulti(keys []string, newValue func() interface{}) (map[string]interface{}, error) {
+	for _, k := range keys {
+		if err := util.CheckKey(k); err != nil {
+			return nil, err
+		}
+	}
+
+	items := make(map[string]*Item, len(keys))
+	var expired bool
+	s.lock.RLock()
+	if s.m == nil {
+		s.lock.RUnlock()
+		return nil, gokv.ErrClosed
+	}
+	for _, k := range keys {
+		if item, found := s.m[k]; found {
+			if item.IsExpired() {
+				expired = true
+				continue
+			}
+			items[k] = item
+		}
+	}
+	s.lock.RUnlock()
+
+	if expired {
+		s.deleteExpired(keys)
+	}
+
+	result := make(map[string]interface{}, len(items))
+	for k, item := range items {
+		v := newValue()
+		if err := s.unmarshal(item.Data, v); err != nil {
+			return nil, err
+		}
+		result[k] = v
+	}
+	return result, nil
+}
+
+// HasMulti reports for each of the given keys whether an unexpired value is stored for it,
+// taking the read lock only once.
+func (s *Store) HasMulti(keys []string) (map[string]bool, error) {
+	for _, k := range keys {
+		if err := util.CheckKey(k); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make(map[string]bool, len(keys))
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.m == nil {
+		return nil, gokv.ErrClosed
+	}
+	for _, k := range keys {
+		item, found := s.m[k]
+		result[k] = found && !item.IsExpired()
+	}
+	return result, nil
+}
+
+// deleteExpired deletes the expired items among keys.
+func (s *Store) deleteExpired(keys []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, k := range keys {
+		if item, found := s.m[k]; found && item.IsExpired() {
+			delete(s.m, k)
+		}
+	}
+}
+
+// DeleteMulti deletes the stored values for the given keys, taking the lock only once.
+// Deleting non-existing key-value pairs does NOT lead to an error.
+func (s *Store) DeleteMulti(keys []string) error {
+	for _, k := range keys {
+		if err := util.CheckKey(k); err != nil {
+			return err
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.m == nil {
+		return gokv.ErrClosed
+	}
+	for _, k := range keys {
+		delete(s.m, k)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package gomap
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/yifeng01/gokv"
+	"github.com/yifeng01/gokv/util"
+)
+
+// SetNX stores v for k only if k doesn't exist or is expired.
+// It reports whether v was stored.
+func (s *Store) SetNX(k string, v interface{}, expires time.Duration) (stored bool, err error) {
+	if err := util.CheckKeyAndValue(k, v); err != nil {
+		return false, err
+	}
+
+	data, err := s.marshal(v)
+	if err != nil {
+		return false, err
+	}
+	item := newItem(data, expires)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.m == nil {
+		return false, gokv.ErrClosed
+	}
+	if current, found := s.m[k]; found && !current.IsExpired() {
+		return false, nil
+	}
+	s.m[k] = item
+	return true, nil
+}
+
+// CompareAndSwap stores new for k only if the stored value of k encodes to the same bytes as old.
+// The expiry of k is kept.
+// It reports whether new was stored.
+func (s *Store) CompareAndSwap(k string, old, new interface{}) (swapped bool, err error) {
+	if err := util.CheckKeyAndValue(k, old); err != nil {
+		return false, err
+	}
+	if err := util.CheckVal(new); err != nil {
+		return false, err
+	}
+
+	oldData, err := s.marshal(old)
+	if err != nil {
+		return false, err
+	}
+	newData, err := s.marshal(new)
+	if err != nil {
+		return false, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.m == nil {
+		return false, gokv.ErrClosed
+	}
+	current, found := s.m[k]
+	if !found || current.IsExpired() || !bytes.Equal(current.Data, oldData) {
+		return false, nil
+	}
+	s.m[k] = &Item{
+		ExpiresAt: current.ExpiresAt,
+		Data:      util.CopyData(newData),
+	}
+	return true, nil
+}
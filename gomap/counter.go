@@ -0,0 +1,46 @@
+package gomap
+
+import (
+	"time"
+
+	"github.com/yifeng01/gokv"
+	"github.com/yifeng01/gokv/util"
+)
+
+// Incr adds delta to the integer stored for k under the store's lock and returns the new value.
+// A missing or expired k starts at 0.
+// If ttl > 0 the expiry of k is set to ttl, otherwise the current expiry is kept.
+func (s *Store) Incr(k string, delta int64, ttl time.Duration) (int64, error) {
+	if err := util.CheckKey(k); err != nil {
+		return 0, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.m == nil {
+		return 0, gokv.ErrClosed
+	}
+
+	var n int64
+	var expiresAt time.Time
+	if current, found := s.m[k]; found && !current.IsExpired() {
+		if err := s.unmarshal(current.Data, &n); err != nil {
+			return 0, err
+		}
+		expiresAt = current.ExpiresAt
+	}
+	n += delta
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	data, err := s.marshal(n)
+	if err != nil {
+		return 0, err
+	}
+	s.m[k] = &Item{
+		ExpiresAt: expiresAt,
+		Data:      util.CopyData(data),
+	}
+	return n, nil
+}
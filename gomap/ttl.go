@@ -0,0 +1,66 @@
+package gomap
+
+import (
+	"time"
+
+	"github.com/yifeng01/gokv"
+	"github.com/yifeng01/gokv/util"
+)
+
+// TTL returns the time left until k expires, 0 means that k never expires.
+func (s *Store) TTL(k string) (ttl time.Duration, found bool, err error) {
+	if err := util.CheckKey(k); err != nil {
+		return 0, false, err
+	}
+
+	item, found, err := s.load(k)
+	if err != nil || !found {
+		return 0, false, err
+	}
+
+	return item.TTL(), true, nil
+}
+
+// Expire sets k to expire after expires, which must be positive.
+// Only the item's expiry is changed, the stored value is kept as is.
+func (s *Store) Expire(k string, expires time.Duration) (found bool, err error) {
+	if err := util.CheckExpires(expires); err != nil {
+		return false, err
+	}
+	return s.setExpiresAt(k, time.Now().Add(expires))
+}
+
+// Persist removes the expiry of k, so that it never expires.
+func (s *Store) Persist(k string) (found bool, err error) {
+	return s.setExpiresAt(k, time.Time{})
+}
+
+// Touch reports whether k exists.
+// The Go map store doesn't track access times, so nothing else is changed.
+func (s *Store) Touch(k string) (found bool, err error) {
+	_, found, err = s.TTL(k)
+	return found, err
+}
+
+// setExpiresAt replaces the item of k by a copy with the given expiry,
+// so readers that already hold the old item aren't affected.
+func (s *Store) setExpiresAt(k string, expiresAt time.Time) (found bool, err error) {
+	if err := util.CheckKey(k); err != nil {
+		return false, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.m == nil {
+		return false, gokv.ErrClosed
+	}
+	item, found := s.m[k]
+	if !found || item.IsExpired() {
+		return false, nil
+	}
+	s.m[k] = &Item{
+		ExpiresAt: expiresAt,
+		Data:      item.Data,
+	}
+	return true, nil
+}
@@ -0,0 +1,50 @@
+package gokv
+
+// Level is the severity of a log message.
+type Level int
+
+// The levels of log messages, from the least to the most severe.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String returns the lower case name of the level, e.g. "warn".
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// Logger receives the log messages of the stores.
+// keyvals are alternating keys and values that describe the message, e.g. "table", "gokv".
+// It must be safe for concurrent use, messages are also logged by background GC passes.
+type Logger interface {
+	Log(level Level, msg string, keyvals ...interface{})
+}
+
+// LoggerFunc adapts a function to the Logger interface.
+type LoggerFunc func(level Level, msg string, keyvals ...interface{})
+
+// Log calls f.
+func (f LoggerFunc) Log(level Level, msg string, keyvals ...interface{}) {
+	f(level, msg, keyvals...)
+}
+
+// NopLogger discards all messages, it is the default Logger of the stores.
+var NopLogger Logger = nopLogger{}
+
+type nopLogger struct{}
+
+func (nopLogger) Log(Level, string, ...interface{}) {}
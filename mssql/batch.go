@@ -0,0 +1,223 @@
+package mssql
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/yifeng01/gokv/util"
+)
+
+const (
+	// SQL Server accepts at most 2100 parameters per statement
+	// and 1000 rows per VALUES clause.
+	_maxBatchKeys = 2000
+	// Each inserted row takes 2 parameters (id, data).
+	_maxBatchRows = 1000
+)
+
+// SetMulti stores all key-value pairs of m inside one transaction.
+// Existing rows are deleted and all rows are written with multi-row INSERT statements,
+// which set the expiry from the database time.
+// Every key expires after expires, 0 means never expire.
+// No key may be "" and no value may be nil.
+func (s *Store) SetMulti(m map[string]interface{}, expires time.Duration) error {
+	if len(m) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(m))
+	args := make([]interface{}, 0, 2*len(m))
+	for k, v := range m {
+		if err := util.CheckKeyAndValue(k, v); err != nil {
+			return err
+		}
+		id, err := s.id(k)
+		if err != nil {
+			return err
+		}
+		data, err := s.marshal(v)
+		if err != nil {
+			return wrapErr(err)
+		}
+		ids = append(ids, id)
+		args = append(args, id, s.dataArg(data))
+	}
+
+	var tables []string
+	err := s.retryMissing(func() (err error) {
+		if tables, err = s.readTables(); err != nil {
+			return err
+		}
+		return s.setMulti(tables[0], ids, args, expires)
+	})
+	if err != nil {
+		return err
+	}
+	return s.deleteOlder(context.Background(), tables, ids)
+}
+
+// setMulti replaces the rows of ids, args holds the id and data arguments of each row.
+func (s *Store) setMulti(table string, ids []string, args []interface{}, expires time.Duration) error {
+	session := s.Sql.engine.NewSession()
+	// Close rolls the transaction back if it wasn't committed.
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return wrapErr(err)
+	}
+
+	for _, chunk := range chunkKeys(ids, _maxBatchKeys) {
+		if _, err := session.Table(table).In("id", chunk).Delete(s.newItem()); err != nil {
+			return wrapErr(err)
+		}
+	}
+	row := "(?, ?, " + expiresAtExpr(expires) + ", " + _now + ")"
+	for start := 0; start < len(ids); start += _maxBatchRows {
+		end := start + _maxBatchRows
+		if end > len(ids) {
+			end = len(ids)
+		}
+		rows := strings.TrimSuffix(strings.Repeat(row+", ", end-start), ", ")
+		stmt := append([]interface{}{"INSERT INTO " + quoteTable(table) + " (id, data, expiresAt, ctime) VALUES " + rows},
+			args[2*start:2*end]...)
+		if _, err := session.Exec(stmt...); err != nil {
+			return wrapErr(err)
+		}
+	}
+
+	return wrapErr(session.Commit())
+}
+
+// GetMulti retrieves the values for the given keys with as few SELECT statements as possible.
+// Expired values are reported as not found.
+// newValue must return a pointer that a found value is unmarshalled into.
+// The returned map only contains the keys that were found.
+func (s *Store) GetMulti(keys []string, newValue func() interface{}) (map[string]interface{}, error) {
+	// Maps the ids back to the keys, which differ for hashed keys.
+	keyOf := make(map[string]string, len(keys))
+	ids := make([]string, len(keys))
+	for i, k := range keys {
+		if err := util.CheckKey(k); err != nil {
+			return nil, err
+		}
+		id, err := s.id(k)
+		if err != nil {
+			return nil, err
+		}
+		keyOf[id] = k
+		ids[i] = id
+	}
+
+	// With Split, the keys that weren't found are looked up in the partition before.
+	result := make(map[string]interface{}, len(keys))
+	err := s.eachTable(func(table string) (bool, error) {
+		var missing []string
+		for _, id := range ids {
+			if _, ok := result[keyOf[id]]; !ok {
+				missing = append(missing, id)
+			}
+		}
+		for _, chunk := range chunkKeys(missing, _maxBatchKeys) {
+			var items []*Item
+			if err := s.Sql.engine.Table(table).In("id", chunk).And(_notExpired).Find(&items); err != nil {
+				return false, err
+			}
+			for _, item := range items {
+				v := newValue()
+				if err := s.unmarshal([]byte(item.Data), v); err != nil {
+					return false, err
+				}
+				result[keyOf[item.Key]] = v
+			}
+		}
+		return len(result) == len(keyOf), nil
+	})
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return result, nil
+}
+
+// HasMulti reports for each of the given keys whether it exists, with as few SELECT statements as possible.
+// Only the ids are selected, the values aren't read. Expired values are reported as not existing.
+func (s *Store) HasMulti(keys []string) (map[string]bool, error) {
+	// Maps the ids back to the keys, which differ for hashed keys.
+	keyOf := make(map[string]string, len(keys))
+	ids := make([]string, len(keys))
+	result := make(map[string]bool, len(keys))
+	for i, k := range keys {
+		if err := util.CheckKey(k); err != nil {
+			return nil, err
+		}
+		id, err := s.id(k)
+		if err != nil {
+			return nil, err
+		}
+		keyOf[id] = k
+		ids[i] = id
+		result[k] = false
+	}
+
+	// With Split, the keys that weren't found are looked up in the partition before.
+	found := 0
+	err := s.eachTable(func(table string) (bool, error) {
+		var missing []string
+		for _, id := range ids {
+			if !result[keyOf[id]] {
+				missing = append(missing, id)
+			}
+		}
+		for _, chunk := range chunkKeys(missing, _maxBatchKeys) {
+			var items []*Item
+			if err := s.Sql.engine.Table(table).Cols("id").In("id", chunk).And(_notExpired).Find(&items); err != nil {
+				return false, err
+			}
+			for _, item := range items {
+				result[keyOf[item.Key]] = true
+				found++
+			}
+		}
+		return found == len(keyOf), nil
+	})
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return result, nil
+}
+
+// DeleteMulti deletes the stored values for the given keys with as few DELETE statements as possible.
+// Deleting non-existing key-value pairs does NOT lead to an error.
+func (s *Store) DeleteMulti(keys []string) error {
+	for _, k := range keys {
+		if err := util.CheckKey(k); err != nil {
+			return err
+		}
+	}
+	ids, err := s.ids(keys)
+	if err != nil {
+		return err
+	}
+
+	err = s.eachTable(func(table string) (bool, error) {
+		for _, chunk := range chunkKeys(ids, _maxBatchKeys) {
+			if _, err := s.Sql.engine.Table(table).In("id", chunk).Delete(s.newItem()); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	})
+	return wrapErr(err)
+}
+
+// chunkKeys splits keys into slices of at most size keys.
+func chunkKeys(keys []string, size int) [][]string {
+	var chunks [][]string
+	for start := 0; start < len(keys); start += size {
+		end := start + size
+		if end > len(keys) {
+			end = len(keys)
+		}
+		chunks = append(chunks, keys[start:end])
+	}
+	return chunks
+}
@@ -0,0 +1,107 @@
+package mssql
+
+import (
+	"context"
+	"time"
+
+	"github.com/yifeng01/gokv/util"
+)
+
+// SetNX stores v for k only if k doesn't exist or is expired.
+// Inside one transaction an expired row is overwritten with a conditional UPDATE,
+// otherwise the row is inserted and a primary key violation means that k exists.
+// It reports whether v was stored.
+func (s *Store) SetNX(k string, v interface{}, expires time.Duration) (stored bool, err error) {
+	if err := util.CheckKeyAndValue(k, v); err != nil {
+		return false, err
+	}
+
+	id, err := s.id(k)
+	if err != nil {
+		return false, err
+	}
+	data, err := s.marshal(v)
+	if err != nil {
+		return false, wrapErr(err)
+	}
+
+	err = s.retryMissing(func() error {
+		table, err := s.promote(context.Background(), id)
+		if err != nil {
+			return err
+		}
+		stored, err = s.setNX(table, id, data, expires)
+		return err
+	})
+	return stored, err
+}
+
+func (s *Store) setNX(table, id string, data []byte, expires time.Duration) (stored bool, err error) {
+	session := s.Sql.engine.NewSession()
+	// Close rolls the transaction back if it wasn't committed.
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return false, wrapErr(err)
+	}
+
+	n, err := session.Table(table).
+		Where("id = ?", id).And(_expired).SetExpr("expiresAt", expiresAtExpr(expires)).SetExpr("ctime", _now).
+		Update(map[string]interface{}{"data": s.dataArg(data)})
+	if err != nil {
+		return false, wrapErr(err)
+	}
+	if n == 0 {
+		if err := s.insert(session, table, id, data, expires); err != nil {
+			if isDuplicateKey(err) {
+				return false, nil
+			}
+			return false, wrapErr(err)
+		}
+	}
+
+	return true, wrapErr(session.Commit())
+}
+
+// CompareAndSwap stores new for k only if the stored value of k encodes to the same bytes as old.
+// It is a single conditional UPDATE that compares the data column and old as binary,
+// so the column's collation doesn't make different values equal.
+// The expiry of k is kept.
+// It reports whether new was stored.
+func (s *Store) CompareAndSwap(k string, old, new interface{}) (swapped bool, err error) {
+	if err := util.CheckKeyAndValue(k, old); err != nil {
+		return false, err
+	}
+	if err := util.CheckVal(new); err != nil {
+		return false, err
+	}
+
+	id, err := s.id(k)
+	if err != nil {
+		return false, err
+	}
+	oldData, err := s.marshal(old)
+	if err != nil {
+		return false, wrapErr(err)
+	}
+	newData, err := s.marshal(new)
+	if err != nil {
+		return false, wrapErr(err)
+	}
+
+	var n int64
+	err = s.retryMissing(func() error {
+		table, err := s.promote(context.Background(), id)
+		if err != nil {
+			return err
+		}
+		n, err = s.Sql.engine.Table(table).
+			Where("id = ?", id).And("CONVERT(varbinary(max), data) = CONVERT(varbinary(max), ?)", s.dataArg(oldData)).
+			And(_notExpired).SetExpr("ctime", _now).
+			Update(map[string]interface{}{"data": s.dataArg(newData)})
+		return wrapErr(err)
+	})
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
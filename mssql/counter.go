@@ -0,0 +1,115 @@
+package mssql
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-xorm/xorm"
+
+	"github.com/yifeng01/gokv/encoding"
+	"github.com/yifeng01/gokv/util"
+)
+
+// Incr adds delta to the integer stored for k and returns the new value.
+// A missing or expired k starts at 0.
+// If ttl > 0 the expiry of k is set to ttl, otherwise the current expiry is kept.
+//
+// With the JSON codec, whose encoding of an integer is its decimal text,
+// an existing counter is incremented by a single UPDATE ... OUTPUT statement.
+// Otherwise, and for missing or expired keys, the row is read with an update lock,
+// and written back inside the same transaction.
+func (s *Store) Incr(k string, delta int64, ttl time.Duration) (int64, error) {
+	if err := util.CheckKey(k); err != nil {
+		return 0, err
+	}
+
+	id, err := s.id(k)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	err = s.retryMissing(func() error {
+		table, err := s.promote(context.Background(), id)
+		if err != nil {
+			return err
+		}
+		n, err = s.incr(table, id, delta, ttl)
+		return err
+	})
+	return n, err
+}
+
+func (s *Store) incr(table, id string, delta int64, ttl time.Duration) (int64, error) {
+	session := s.Sql.engine.NewSession()
+	// Close rolls the transaction back if it wasn't committed.
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return 0, wrapErr(err)
+	}
+
+	if _, ok := s.Codec.(encoding.JSONcodec); ok {
+		set := "data = CONVERT(nvarchar(20), CONVERT(bigint, data) + ?), ctime = " + _now
+		if ttl > 0 {
+			set += ", expiresAt = " + expiresAtExpr(ttl)
+		}
+		rows, err := session.QueryString(
+			"UPDATE "+quoteTable(table)+" SET "+set+" OUTPUT inserted.data WHERE id = ? AND ("+_notExpired+")",
+			delta, id)
+		if err != nil {
+			return 0, wrapErr(err)
+		}
+		if len(rows) == 1 {
+			n, err := strconv.ParseInt(rows[0]["data"], 10, 64)
+			if err != nil {
+				return 0, wrapErr(err)
+			}
+			return n, wrapErr(session.Commit())
+		}
+	}
+
+	n, err := s.incrLocked(session, table, id, delta, ttl)
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+	return n, wrapErr(session.Commit())
+}
+
+// incrLocked reads the row of id with an update lock, which also locks the key if it doesn't exist,
+// and writes the incremented value back.
+// Whether the row is expired is decided by the database.
+func (s *Store) incrLocked(session *xorm.Session, table, id string, delta int64, ttl time.Duration) (int64, error) {
+	rows, err := session.QueryString("SELECT data, CASE WHEN "+_notExpired+" THEN 1 ELSE 0 END AS live"+
+		" FROM "+quoteTable(table)+" WITH (UPDLOCK, HOLDLOCK) WHERE id = ?", id)
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+	found := len(rows) == 1
+	live := found && rows[0]["live"] == "1"
+
+	var n int64
+	if live {
+		if err := s.unmarshal([]byte(rows[0]["data"]), &n); err != nil {
+			return 0, err
+		}
+	}
+	n += delta
+
+	data, err := s.marshal(n)
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+
+	if !found {
+		return n, wrapErr(s.insert(session, table, id, data, ttl))
+	}
+
+	// The expiry of a live counter is kept unless ttl is set, an expired counter starts without one.
+	write := session.Table(table).Where("id = ?", id).SetExpr("ctime", _now)
+	if ttl > 0 || !live {
+		write = write.SetExpr("expiresAt", expiresAtExpr(ttl))
+	}
+	_, err = write.Update(map[string]interface{}{"data": s.dataArg(data)})
+	return n, wrapErr(err)
+}
@@ -0,0 +1,47 @@
+package mssql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dialect supplies the statements whose syntax differs between SQL databases.
+type dialect interface {
+	// createTable returns the statement that creates table with the store's columns if it doesn't exist yet.
+	// It takes no arguments.
+	createTable(table string, keyLength int, dataType string) string
+	// upsert returns a single atomic statement that inserts the row of a key,
+	// or replaces its data and expiry if it exists.
+	// It takes the id and the data as arguments, followed by the arguments of expiresAt,
+	// which is the SQL expression for the row's expiry.
+	upsert(table, expiresAt string) string
+}
+
+// sqlServer is the dialect of SQL Server.
+type sqlServer struct{}
+
+func (sqlServer) createTable(table string, keyLength int, dataType string) string {
+	return fmt.Sprintf("IF OBJECT_ID(N'%s', N'U') IS NULL CREATE TABLE %s ("+
+		"id varchar(%d) NOT NULL PRIMARY KEY, data %s NOT NULL, expiresAt datetime NULL, ctime datetime NULL)",
+		escapeString(quoteTable(table)), quoteTable(table), keyLength, dataType)
+}
+
+// upsert returns a MERGE statement.
+// HOLDLOCK keeps the range of the key locked between the match and the write,
+// otherwise two sessions could both miss the row and the second insert would fail with a duplicate key.
+func (sqlServer) upsert(table, expiresAt string) string {
+	return "MERGE " + quoteTable(table) + " WITH (HOLDLOCK) AS t" +
+		" USING (SELECT ? AS id, ? AS data, " + expiresAt + " AS expiresAt) AS s ON t.id = s.id" +
+		" WHEN MATCHED THEN UPDATE SET data = s.data, expiresAt = s.expiresAt, ctime = " + _now +
+		" WHEN NOT MATCHED THEN INSERT (id, data, expiresAt, ctime) VALUES (s.id, s.data, s.expiresAt, " + _now + ");"
+}
+
+// quoteTable quotes a table name for use in a raw statement.
+func quoteTable(name string) string {
+	return "[" + strings.Replace(name, "]", "]]", -1) + "]"
+}
+
+// escapeString escapes s for use inside a string literal of a raw statement.
+func escapeString(s string) string {
+	return strings.Replace(s, "'", "''", -1)
+}
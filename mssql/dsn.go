@@ -1,9 +1,12 @@
 package mssql
 
 import (
-	"bytes"
-	"log"
+	"fmt"
+	"net"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	_ "github.com/denisenkom/go-mssqldb"
 	"github.com/go-xorm/xorm"
@@ -12,6 +15,21 @@ import (
 
 const (
 	_defMSSqlDriverName = "mssql"
+
+	_defMaxOpenConns = 20
+	_defMaxIdleConns = 10
+)
+
+// Encrypt is the encryption of the connection to the server.
+type Encrypt string
+
+const (
+	// EncryptDisable sends all data unencrypted, including the login.
+	EncryptDisable Encrypt = "disable"
+	// EncryptLogin only encrypts the login packet, which is the driver's default.
+	EncryptLogin Encrypt = "false"
+	// EncryptOn encrypts all data with TLS.
+	EncryptOn Encrypt = "true"
 )
 
 type SqlSvr struct {
@@ -20,44 +38,94 @@ type SqlSvr struct {
 	split  bool
 }
 
-func (s *SqlSvr) Close() {
+// Close closes the engine and all of its connections.
+func (s *SqlSvr) Close() error {
+	return s.engine.Close()
 }
 
-func newSqlSvr(user, pwd, host, db, tb string, split bool) *SqlSvr {
-	dsn := getMssqlDsn(user, pwd, host, db)
-	engine, err := xorm.NewEngine(_defMSSqlDriverName, dsn)
+// newSqlSvr creates the engine of a store, whose log messages go to options.Logger.
+// The executed SQL statements are only logged with options.ShowSQL, they contain the stored data.
+func newSqlSvr(options Options) (*SqlSvr, error) {
+	engine, err := xorm.NewEngine(_defMSSqlDriverName, getMssqlDsn(options))
 	if err != nil {
-		log.Printf("newSqlSvr: err=%s,host=%s,db=%s,user=%s\n", err, host, db, user)
-		return nil
+		return nil, fmt.Errorf("mssql: can't create engine for host=%s, db=%s, user=%s: %w",
+			options.Host, options.Db, options.User, wrapErr(err))
 	}
 
 	//设置参数
-	engine.ShowSQL(true)
-	engine.ShowExecTime(true)
-	engine.SetMaxIdleConns(10)
-	engine.SetMaxOpenConns(20)
+	engine.SetLogger(&xormLogger{logger: options.Logger, showSQL: options.ShowSQL})
+	engine.ShowExecTime(options.ShowSQL)
+	engine.SetMaxIdleConns(options.MaxIdleConns)
+	engine.SetMaxOpenConns(options.MaxOpenConns)
+	engine.SetConnMaxLifetime(options.ConnMaxLifetime)
+	engine.DB().SetConnMaxIdleTime(options.ConnMaxIdleTime)
 	engine.SetMapper(core.GonicMapper{})
+	// Expiry is computed by the database in UTC, so all other times are written in UTC too.
+	engine.SetTZLocation(time.UTC)
+	engine.SetTZDatabase(time.UTC)
 	engine.Sync()
 
 	return &SqlSvr{
 		engine: engine,
-		table:  tb,
-		split:  split,
-	}
+		table:  options.TableName,
+		split:  options.Split,
+	}, nil
 }
 
 //////////////////////////////////////////////////////
 //组数据源名字
-func getMssqlDsn(user, pwd, host, database string) string {
-	var buffer bytes.Buffer
-	buffer.WriteString("sqlserver://")
-	buffer.WriteString(user)
-	buffer.WriteString(":")
-	buffer.WriteString(url.QueryEscape(pwd))
-	buffer.WriteString("@")
-	buffer.WriteString(host)
-	buffer.WriteString("?database=")
-	buffer.WriteString(database)
-	buffer.WriteString("&encrypt=disable")
-	return buffer.String()
+
+// getMssqlDsn returns options.DSN if it is set, otherwise the sqlserver:// URL of the connection options.
+// Every component is escaped, so e.g. a user name or database may contain any character.
+func getMssqlDsn(options Options) string {
+	if options.DSN != "" {
+		return options.DSN
+	}
+
+	host, instance := options.Host, options.Instance
+	// Older versions took the instance as part of the host, e.g. "server\SQLEXPRESS".
+	if i := strings.IndexByte(host, '\\'); i >= 0 && instance == "" {
+		host, instance = host[:i], host[i+1:]
+	}
+	if options.Port != 0 {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = net.JoinHostPort(host, strconv.Itoa(options.Port))
+	}
+
+	query := url.Values{}
+	query.Set("database", options.Db)
+	encrypt := options.Encrypt
+	if encrypt == "" {
+		encrypt = EncryptDisable
+	}
+	query.Set("encrypt", string(encrypt))
+	if options.TrustServerCertificate {
+		query.Set("TrustServerCertificate", "true")
+	}
+	if options.Certificate != "" {
+		query.Set("certificate", options.Certificate)
+	}
+	if options.HostNameInCertificate != "" {
+		query.Set("hostNameInCertificate", options.HostNameInCertificate)
+	}
+	if options.AppName != "" {
+		query.Set("app name", options.AppName)
+	}
+	if options.ConnTimeout > 0 {
+		// The driver takes whole seconds, a shorter timeout is rounded up so that it isn't dropped.
+		query.Set("connection timeout", strconv.FormatInt(int64((options.ConnTimeout+time.Second-1)/time.Second), 10))
+	}
+
+	u := url.URL{
+		Scheme:   "sqlserver",
+		User:     url.UserPassword(options.User, options.Pwd),
+		Host:     host,
+		RawQuery: query.Encode(),
+	}
+	if instance != "" {
+		u.Path = "/" + instance
+	}
+	return u.String()
 }
@@ -0,0 +1,106 @@
+package mssql
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetMssqlDsn(t *testing.T) {
+	const special = "a@b:c/d?e&f;g=h i"
+	tests := []struct {
+		name     string
+		options  Options
+		host     string
+		path     string
+		user     string
+		password string
+		query    map[string]string
+	}{
+		{
+			name:     "special characters",
+			options:  Options{Host: "db.example.com", User: special, Pwd: special + "%", Db: special},
+			host:     "db.example.com",
+			user:     special,
+			password: special + "%",
+			query:    map[string]string{"database": special, "encrypt": "disable"},
+		},
+		{
+			name:    "port replaces the port in host",
+			options: Options{Host: "db.example.com:1000", Port: 1433, Db: "gokv"},
+			host:    "db.example.com:1433",
+			query:   map[string]string{"database": "gokv", "encrypt": "disable"},
+		},
+		{
+			name:    "port with an IPv6 host",
+			options: Options{Host: "::1", Port: 1433, Db: "gokv"},
+			host:    "[::1]:1433",
+			query:   map[string]string{"database": "gokv", "encrypt": "disable"},
+		},
+		{
+			name:    "instance in host",
+			options: Options{Host: `db\SQLEXPRESS`, Db: "gokv"},
+			host:    "db",
+			path:    "/SQLEXPRESS",
+			query:   map[string]string{"database": "gokv", "encrypt": "disable"},
+		},
+		{
+			name:    "instance",
+			options: Options{Host: "db", Port: 1434, Instance: "my instance", Db: "gokv"},
+			host:    "db:1434",
+			path:    "/my instance",
+			query:   map[string]string{"database": "gokv", "encrypt": "disable"},
+		},
+		{
+			name:    "app name and connection timeout",
+			options: Options{Host: "db", Db: "gokv", AppName: special, ConnTimeout: 1500 * time.Millisecond},
+			host:    "db",
+			query: map[string]string{"database": "gokv", "encrypt": "disable",
+				"app name": special, "connection timeout": "2"},
+		},
+		{
+			name: "tls",
+			options: Options{Host: "db", Db: "gokv", Encrypt: EncryptOn, TrustServerCertificate: true,
+				Certificate: "/etc/ssl/my ca.pem", HostNameInCertificate: "*.example.com"},
+			host: "db",
+			query: map[string]string{"database": "gokv", "encrypt": "true", "TrustServerCertificate": "true",
+				"certificate": "/etc/ssl/my ca.pem", "hostNameInCertificate": "*.example.com"},
+		},
+		{
+			name:    "encrypt login",
+			options: Options{Host: "db", Db: "gokv", Encrypt: EncryptLogin},
+			host:    "db",
+			query:   map[string]string{"database": "gokv", "encrypt": "false"},
+		},
+	}
+
+	for _, test := range tests {
+		u, err := url.Parse(getMssqlDsn(test.options))
+		if err != nil {
+			t.Errorf("%s: Parse: err=%v", test.name, err)
+			continue
+		}
+		if u.Scheme != "sqlserver" || u.Host != test.host || u.Path != test.path {
+			t.Errorf("%s: scheme=%q, host=%q, path=%q", test.name, u.Scheme, u.Host, u.Path)
+		}
+		if password, _ := u.User.Password(); u.User.Username() != test.user || password != test.password {
+			t.Errorf("%s: user=%q, password=%q", test.name, u.User.Username(), password)
+		}
+
+		query := make(map[string]string)
+		for name, values := range u.Query() {
+			if len(values) != 1 {
+				t.Errorf("%s: query %s=%q", test.name, name, values)
+			}
+			query[name] = values[0]
+		}
+		if !reflect.DeepEqual(query, test.query) {
+			t.Errorf("%s: query=%v, want %v", test.name, query, test.query)
+		}
+	}
+
+	if dsn := getMssqlDsn(Options{DSN: "sqlserver://sa@db?database=x", Host: "other"}); dsn != "sqlserver://sa@db?database=x" {
+		t.Errorf("DSN: dsn=%q", dsn)
+	}
+}
@@ -0,0 +1,85 @@
+package mssql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+
+	"github.com/yifeng01/gokv"
+	"github.com/yifeng01/gokv/util"
+)
+
+// Error numbers reported by SQL Server.
+const (
+	// Invalid object name, i.e. the table doesn't exist.
+	_errInvalidObjectName = 208
+	// Violation of a primary key constraint.
+	_errDuplicateKey = 2627
+	// The database of the login can't be opened.
+	_errCannotOpenDatabase = 4060
+	// Login failed.
+	_errLoginFailed = 18456
+)
+
+// database/sql doesn't export this error, so it can only be recognized by its message.
+const _errMsgClosed = "sql: database is closed"
+
+// sqlErrorNumber returns the SQL Server error number of err, 0 if err wasn't reported by SQL Server.
+func sqlErrorNumber(err error) int32 {
+	var e mssql.Error
+	if errors.As(err, &e) {
+		return e.SQLErrorNumber()
+	}
+	return 0
+}
+
+// isMissingTable reports whether err was caused by a table that doesn't exist.
+func isMissingTable(err error) bool {
+	return sqlErrorNumber(err) == _errInvalidObjectName
+}
+
+// isDuplicateKey reports whether err was caused by inserting a key that already exists.
+func isDuplicateKey(err error) bool {
+	return sqlErrorNumber(err) == _errDuplicateKey
+}
+
+// wrapErr maps database errors onto the gokv errors.
+// Connection and login failures make the store unavailable,
+// errors reported by SQL Server are reported as gokv.ErrBackend.
+func wrapErr(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var netErr net.Error
+	switch {
+	case err.Error() == _errMsgClosed:
+		return util.WrapError(gokv.ErrClosed, err)
+	case errors.Is(err, driver.ErrBadConn),
+		errors.Is(err, sql.ErrConnDone),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.As(err, &netErr):
+		return util.WrapError(gokv.ErrBackendUnavailable, err)
+	}
+	switch sqlErrorNumber(err) {
+	case _errCannotOpenDatabase, _errLoginFailed:
+		return util.WrapError(gokv.ErrBackendUnavailable, err)
+	}
+	return util.WrapError(gokv.ErrBackend, err)
+}
+
+// marshal encodes v with the store's codec.
+func (s *Store) marshal(v interface{}) ([]byte, error) {
+	data, err := s.Codec.Marshal(v)
+	return data, util.WrapError(gokv.ErrCodec, err)
+}
+
+// unmarshal decodes data into v with the store's codec.
+func (s *Store) unmarshal(data []byte, v interface{}) error {
+	return util.WrapError(gokv.ErrCodec, s.Codec.Unmarshal(data, v))
+}
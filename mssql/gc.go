@@ -0,0 +1,261 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/yifeng01/gokv"
+	"github.com/yifeng01/gokv/util"
+)
+
+// _defGCBatchSize is the default number of rows deleted per statement by GC.
+// It stays below the 5000 locks at which SQL Server escalates row locks to a table lock.
+const _defGCBatchSize = 1000
+
+// GC deletes the expired rows of the store's table, or of all partition tables if the store is split.
+// A partition table before the current one is dropped once it has no unexpired rows left.
+// Only the unexpired rows of the oldest of the FallbackPartitions that reads look at, and of older tables,
+// are moved into the current table, so that they outlive the fallback partitions.
+// Rows that expire before their partition becomes the oldest fallback partition are never moved.
+// The rows are deleted in batches of Options.GCBatchSize, each batch in its own statement,
+// so a sweep never holds many locks at once.
+// An exclusive application lock makes sure that only one instance sweeps a table at a time,
+// a pass on another instance skips the tables it can't lock.
+// Only expired rows are visited, so GCStats.Scanned is the same as GCStats.Removed.
+func (s *Store) GC() gokv.GCStats {
+	return s.gc(context.Background())
+}
+
+// gc is like GC, but stops between two batches when ctx is done.
+func (s *Store) gc(ctx context.Context) (stats gokv.GCStats) {
+	start := time.Now()
+	defer func() {
+		stats.Scanned = stats.Removed
+		stats.Duration = time.Since(start)
+	}()
+
+	tables, err := s.tables(ctx)
+	if err != nil {
+		stats.Err = err
+		return stats
+	}
+	// The table that the rows of old partition tables are moved into.
+	current, err := s.table()
+	if err != nil {
+		stats.Err = err
+		return stats
+	}
+
+	// The application lock is owned by the session, so all statements must use the same connection.
+	conn, err := s.Sql.engine.DB().Conn(ctx)
+	if err != nil {
+		stats.Err = wrapErr(err)
+		return stats
+	}
+	defer conn.Close()
+
+	for _, table := range tables {
+		into := ""
+		old, move := s.oldPartition(table)
+		if move {
+			into = current
+		}
+		removed, err := s.sweep(ctx, conn, table, into, old)
+		stats.Removed += removed
+		if err != nil {
+			stats.Err = err
+			return stats
+		}
+	}
+	return stats
+}
+
+// sweep deletes the expired rows of table in batches while holding the table's application lock.
+// If into is set, the unexpired rows are then moved into the table into.
+// If drop is set, table is dropped if it is empty then.
+// Nothing is deleted if another session holds the lock.
+func (s *Store) sweep(ctx context.Context, conn *sql.Conn, table, into string, drop bool) (removed int, err error) {
+	resource := "gokv:gc:" + table
+	// The "mssql" driver only binds "?" placeholders, it would reject the argument of "@p1".
+	var status int
+	err = conn.QueryRowContext(ctx, `DECLARE @status int;
+EXEC @status = sp_getapplock @Resource = ?, @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = 0;
+SELECT @status;`, resource).Scan(&status)
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+	if status < 0 {
+		// Another instance is sweeping the table.
+		return 0, nil
+	}
+	defer func() {
+		// Use a fresh context, the lock must also be released when ctx is done.
+		_, releaseErr := conn.ExecContext(context.Background(),
+			"EXEC sp_releaseapplock @Resource = ?, @LockOwner = 'Session'", resource)
+		if err == nil {
+			err = wrapErr(releaseErr)
+		}
+	}()
+
+	query := fmt.Sprintf("DELETE TOP (%d) FROM %s WHERE %s", s.gcBatchSize, quoteTable(table), _expired)
+	for {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+		res, err := conn.ExecContext(ctx, query)
+		if err != nil {
+			return removed, wrapErr(err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return removed, wrapErr(err)
+		}
+		removed += int(n)
+		if n < int64(s.gcBatchSize) {
+			break
+		}
+	}
+
+	if into != "" {
+		if err := s.moveRows(ctx, conn, table, into); err != nil {
+			return removed, err
+		}
+	}
+	if drop {
+		// Writes go to the current table only, so an empty older table stays empty.
+		name := quoteTable(table)
+		var dropped int
+		err := conn.QueryRowContext(ctx, "IF NOT EXISTS (SELECT 1 FROM "+name+")"+
+			" BEGIN DROP TABLE "+name+"; SELECT 1; END ELSE SELECT 0;").Scan(&dropped)
+		if err != nil {
+			return removed, wrapErr(err)
+		}
+		if dropped == 1 {
+			s.known.Delete(table)
+			s.logger.Log(gokv.LevelInfo, "mssql: dropped empty partition table", "table", table)
+		}
+	}
+	return removed, nil
+}
+
+// moveRows moves the unexpired rows of table into the table into in batches,
+// each batch with a single DELETE whose OUTPUT inserts the rows, so that no row is lost or copied twice.
+// A row whose id the table into already has was overwritten since, and is only deleted.
+func (s *Store) moveRows(ctx context.Context, conn *sql.Conn, table, into string) error {
+	from, to := quoteTable(table), quoteTable(into)
+	// The locks of the NOT EXISTS keep concurrent writes of the same id from inserting it twice.
+	stmts := []string{
+		fmt.Sprintf("DELETE TOP (%d) o OUTPUT deleted.id, deleted.data, deleted.expiresAt, deleted.ctime"+
+			" INTO %s (id, data, expiresAt, ctime) FROM %s AS o WHERE (%s)"+
+			" AND NOT EXISTS (SELECT 1 FROM %s AS n WITH (UPDLOCK, HOLDLOCK) WHERE n.id = o.id)",
+			s.gcBatchSize, to, from, _notExpired, to),
+		fmt.Sprintf("DELETE TOP (%d) o FROM %s AS o WHERE EXISTS (SELECT 1 FROM %s AS n WHERE n.id = o.id)",
+			s.gcBatchSize, from, to),
+	}
+	moved := 0
+	for i, stmt := range stmts {
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			res, err := conn.ExecContext(ctx, stmt)
+			if err != nil {
+				return wrapErr(err)
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return wrapErr(err)
+			}
+			if i == 0 {
+				moved += int(n)
+			}
+			if n < int64(s.gcBatchSize) {
+				break
+			}
+		}
+	}
+	if moved > 0 {
+		s.logger.Log(gokv.LevelInfo, "mssql: moved rows of old partition table", "table", table, "into", into, "rows", moved)
+	}
+	return nil
+}
+
+// tables returns the names of the store's existing tables.
+// Those are the table itself and, if the store is split, all of its partition tables.
+func (s *Store) tables(ctx context.Context) ([]string, error) {
+	rows, err := s.Sql.engine.Context(ctx).QueryString(
+		`SELECT name FROM sys.tables WHERE name = ? OR name LIKE ? ESCAPE '\'`,
+		s.Sql.table, escapeLike(s.Sql.table)+"%")
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	tables := make([]string, 0, len(rows))
+	for _, row := range rows {
+		name := row["name"]
+		if name == s.Sql.table {
+			tables = append(tables, name)
+			continue
+		}
+		if _, ok := s.isPartitionTable(name); ok && s.Sql.split {
+			tables = append(tables, name)
+		}
+	}
+	return tables, nil
+}
+
+// oldPartition reports whether table is a partition table before the current one,
+// and whether it is the oldest of the FallbackPartitions or older, whose unexpired rows GC moves.
+func (s *Store) oldPartition(table string) (old, move bool) {
+	if !s.Sql.split {
+		return false, false
+	}
+	start, ok := s.isPartitionTable(table)
+	current := s.partition.start(s.clock.Now())
+	if !ok || !start.Before(current) {
+		return false, false
+	}
+
+	oldest := current
+	for i := 0; i < s.fallbackPartitions; i++ {
+		oldest = s.partition.prev(oldest)
+	}
+	return true, !start.After(oldest)
+}
+
+// auto GC
+// It runs until ctx is done, onGC (if not nil) gets the results of every pass.
+func (s *Store) autoGC(ctx context.Context, interval time.Duration, onGC func(gokv.GCStats)) {
+	defer close(s.gcDone)
+	if interval == 0 {
+		interval = 30 * time.Second
+	}
+
+	tk := time.NewTicker(interval)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tk.C:
+			stats := s.gc(ctx)
+			util.LogGC(s.logger, "mssql", stats)
+			if onGC != nil {
+				onGC(stats)
+			}
+		}
+	}
+}
+
+// stopGC stops the auto GC, a running pass is aborted after the current batch,
+// and waits until it has returned.
+func (s *Store) stopGC() {
+	if s.gcCancel == nil {
+		return
+	}
+	s.gcCancel()
+	<-s.gcDone
+}
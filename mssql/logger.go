@@ -0,0 +1,57 @@
+package mssql
+
+import (
+	"fmt"
+
+	"github.com/yifeng01/gokv"
+	"xorm.io/core"
+)
+
+// xormLogger routes the log messages of the xorm engine to a gokv.Logger.
+// The SQL statements that are traced with Options.ShowSQL are logged at gokv.LevelInfo.
+type xormLogger struct {
+	logger  gokv.Logger
+	level   core.LogLevel
+	showSQL bool
+}
+
+var _ core.ILogger = (*xormLogger)(nil)
+
+func (l *xormLogger) log(level core.LogLevel, msg string) {
+	if level < l.level {
+		return
+	}
+	switch level {
+	case core.LOG_DEBUG:
+		l.logger.Log(gokv.LevelDebug, "mssql: "+msg)
+	case core.LOG_INFO:
+		l.logger.Log(gokv.LevelInfo, "mssql: "+msg)
+	case core.LOG_WARNING:
+		l.logger.Log(gokv.LevelWarn, "mssql: "+msg)
+	default:
+		l.logger.Log(gokv.LevelError, "mssql: "+msg)
+	}
+}
+
+func (l *xormLogger) Debug(v ...interface{}) { l.log(core.LOG_DEBUG, fmt.Sprint(v...)) }
+func (l *xormLogger) Debugf(format string, v ...interface{}) {
+	l.log(core.LOG_DEBUG, fmt.Sprintf(format, v...))
+}
+func (l *xormLogger) Info(v ...interface{}) { l.log(core.LOG_INFO, fmt.Sprint(v...)) }
+func (l *xormLogger) Infof(format string, v ...interface{}) {
+	l.log(core.LOG_INFO, fmt.Sprintf(format, v...))
+}
+func (l *xormLogger) Warn(v ...interface{}) { l.log(core.LOG_WARNING, fmt.Sprint(v...)) }
+func (l *xormLogger) Warnf(format string, v ...interface{}) {
+	l.log(core.LOG_WARNING, fmt.Sprintf(format, v...))
+}
+func (l *xormLogger) Error(v ...interface{}) { l.log(core.LOG_ERR, fmt.Sprint(v...)) }
+func (l *xormLogger) Errorf(format string, v ...interface{}) {
+	l.log(core.LOG_ERR, fmt.Sprintf(format, v...))
+}
+
+func (l *xormLogger) Level() core.LogLevel      { return l.level }
+func (l *xormLogger) SetLevel(lv core.LogLevel) { l.level = lv }
+
+func (l *xormLogger) ShowSQL(show ...bool) { l.showSQL = len(show) == 0 || show[0] }
+func (l *xormLogger) IsShowSQL() bool      { return l.showSQL }
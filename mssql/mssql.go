@@ -1,9 +1,14 @@
 package mssql
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"sync"
 	"time"
 
+	"github.com/go-xorm/xorm"
+
+	"github.com/yifeng01/gokv"
 	"github.com/yifeng01/gokv/encoding"
 	"github.com/yifeng01/gokv/util"
 )
@@ -12,6 +17,24 @@ import (
 type Store struct {
 	Sql   *SqlSvr
 	Codec encoding.Codec
+
+	gcBatchSize int
+	// Length of the id column, and whether longer keys are hashed to fit.
+	keyLength    int
+	hashLongKeys bool
+
+	dialect dialect
+	// Whether tables exist, by name.
+	known sync.Map
+
+	partition          Partition
+	fallbackPartitions int
+	clock              gokv.Clock
+
+	logger gokv.Logger
+	// For stopping the auto GC, nil if it's disabled.
+	gcCancel context.CancelFunc
+	gcDone   chan struct{}
 }
 
 // Set stores the given value for the given key.
@@ -23,34 +46,52 @@ func (s *Store) Set(k string, v interface{}) error {
 
 // SetEx store the give value for the given key and the key expire after expires.
 func (s *Store) SetEx(k string, v interface{}, expires time.Duration) error {
+	return s.SetExCtx(context.Background(), k, v, expires)
+}
+
+// SetCtx is like Set, but aborts when ctx is done.
+func (s *Store) SetCtx(ctx context.Context, k string, v interface{}) error {
+	return s.SetExCtx(ctx, k, v, 0)
+}
+
+// SetExCtx is like SetEx, but aborts when ctx is done.
+// The context is passed on to the database driver.
+func (s *Store) SetExCtx(ctx context.Context, k string, v interface{}, expires time.Duration) error {
 	if err := util.CheckKeyAndValue(k, v); err != nil {
 		return err
 	}
-
-	data, err := s.Codec.Marshal(v)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	id, err := s.id(k)
 	if err != nil {
 		return err
 	}
 
-	var item *Item
-	if expires == 0 {
-		item = &Item{
-			Key:   k,
-			Data:  string(data),
-			Table: s.Sql.table,
-			Split: s.Sql.split,
-		}
-	} else {
-		item = &Item{
-			Key:       k,
-			Data:      string(data),
-			ExpiresAt: time.Now().Add(expires),
-			Table:     s.Sql.table,
-			Split:     s.Sql.split,
-		}
+	data, err := s.marshal(v)
+	if err != nil {
+		return wrapErr(err)
 	}
 
-	return Insert(s.Sql.engine, item)
+	return s.set(ctx, id, data, expires)
+}
+
+// set inserts the row of id, or replaces it if it exists, with a single upsert statement.
+// The row expires after expires, 0 means never expire.
+// With Split, the row is written to the current partition and deleted from the older ones.
+func (s *Store) set(ctx context.Context, id string, data []byte, expires time.Duration) error {
+	var tables []string
+	err := s.retryMissing(func() (err error) {
+		if tables, err = s.readTables(); err != nil {
+			return err
+		}
+		_, err = s.Sql.engine.Context(ctx).Exec(s.dialect.upsert(tables[0], expiresAtExpr(expires)), id, s.dataArg(data))
+		return wrapErr(err)
+	})
+	if err != nil {
+		return err
+	}
+	return s.deleteOlder(ctx, tables, []string{id})
 }
 
 // Get retrieves the stored value for the given key.
@@ -60,119 +101,262 @@ func (s *Store) SetEx(k string, v interface{}, expires time.Duration) error {
 // If no value is found it returns (false, nil).
 // The key must not be "" and the pointer must not be nil.
 func (s *Store) Get(k string, v interface{}) (found bool, err error) {
+	return s.GetCtx(context.Background(), k, v)
+}
+
+// GetCtx is like Get, but aborts when ctx is done.
+// The context is passed on to the database driver.
+func (s *Store) GetCtx(ctx context.Context, k string, v interface{}) (found bool, err error) {
 	if err := util.CheckKeyAndValue(k, v); err != nil {
 		return false, err
 	}
-
-	item := &Item{
-		Table: s.Sql.table,
-		Split: s.Sql.split,
+	if err := ctx.Err(); err != nil {
+		return false, err
 	}
-	found, err = s.Sql.engine.Where("id = ?", k).Get(item)
-	if err != nil || !found {
+	id, err := s.id(k)
+	if err != nil {
 		return false, err
 	}
 
-	return true, s.Codec.Unmarshal([]byte(item.Data), v)
+	// With Split, the partitions are read from the current one back.
+	item := s.newItem()
+	err = s.eachTable(func(table string) (bool, error) {
+		found, err = s.byKey(ctx, table, id).And(_notExpired).Get(item)
+		return found, err
+	})
+	if err != nil || !found {
+		return false, wrapErr(err)
+	}
+
+	return true, s.unmarshal([]byte(item.Data), v)
 }
 
+// Has judge store has a key for k
 func (s *Store) Has(k string) bool {
+	return s.HasCtx(context.Background(), k)
+}
+
+// HasCtx is like Has, but returns false when ctx is done.
+// The context is passed on to the database driver.
+func (s *Store) HasCtx(ctx context.Context, k string) bool {
 	if err := util.CheckKey(k); err != nil {
 		return false
 	}
-
-	item := Item{
-		Key:   k,
-		Table: s.Sql.table,
-		Split: s.Sql.split,
+	if ctx.Err() != nil {
+		return false
 	}
-	if found, err := s.Sql.engine.Get(&item); err != nil || !found {
+	id, err := s.id(k)
+	if err != nil {
 		return false
 	}
 
-	return true
+	var found bool
+	err = s.eachTable(func(table string) (bool, error) {
+		found, err = s.byKey(ctx, table, id).And(_notExpired).Cols("id").Get(s.newItem())
+		return found, err
+	})
+
+	return err == nil && found
 }
 
 // Delete deletes the stored value for the given key.
 // Deleting a non-existing key-value pair does NOT lead to an error.
 // The key must not be "".
 func (s *Store) Delete(k string) error {
+	return s.DeleteCtx(context.Background(), k)
+}
+
+// DeleteCtx is like Delete, but aborts when ctx is done.
+// The context is passed on to the database driver.
+func (s *Store) DeleteCtx(ctx context.Context, k string) error {
 	if err := util.CheckKey(k); err != nil {
 		return err
 	}
-
-	item := Item{
-		Key:   k,
-		Table: s.Sql.table,
-		Split: s.Sql.split,
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-	_, err := s.Sql.engine.Delete(&item)
-	return err
+	id, err := s.id(k)
+	if err != nil {
+		return err
+	}
+
+	// With Split, the key is deleted from all partitions that reads look at.
+	err = s.eachTable(func(table string) (bool, error) {
+		_, err := s.byKey(ctx, table, id).Delete(s.newItem())
+		return false, err
+	})
+	return wrapErr(err)
 }
 
 // Close closes the Store.
 // It must be called to return all open connections to the connection pool and to release any open resources.
+// The auto GC is stopped first, a running pass is aborted after the current batch.
+// Using the store afterwards results in gokv.ErrClosed.
 func (s *Store) Close() error {
-	s.Sql.Close()
-	return nil
+	s.stopGC()
+	return wrapErr(s.Sql.Close())
 }
 
-// GC recycle expire items
-func (s *Store) GC() {
-	log.Println("[mssql]GC begin....")
-
-	tm := time.Now()
-	log.Println("[mssql]GC tm=", tm)
+// Expiry is computed and compared with the database's clock in UTC,
+// so the clocks of the app servers don't matter.
+const (
+	// _now is the current database time.
+	_now = "SYSUTCDATETIME()"
+	// _notExpired is the condition for rows that aren't expired.
+	_notExpired = "expiresAt IS NULL OR expiresAt > " + _now
+	// _expired is the condition for rows that are expired.
+	_expired = "expiresAt <= " + _now
+)
 
-	item := &Item{
-		Table: s.Sql.table,
-		Split: s.Sql.split,
-	}
-	count, err := s.Sql.engine.Where("expiresAt < ?", tm).Delete(item)
-	if err != nil {
-		log.Println("[mssql]GC: err=", err)
-		return
+// expiresAtExpr returns the expression for the database time after expires, NULL (never expire) for 0.
+// DATEADD only takes an int, so seconds and milliseconds are added separately.
+func expiresAtExpr(expires time.Duration) string {
+	if expires <= 0 {
+		return "NULL"
 	}
-
-	log.Printf("[mssql]GC end...[del=%v]\n", count)
+	return fmt.Sprintf("DATEADD(millisecond, %d, DATEADD(second, %d, %s))",
+		(expires % time.Second).Milliseconds(), int64(expires/time.Second), _now)
 }
 
-// auto GC
-func (s *Store) autoGC(interval time.Duration) {
-	if interval == 0 {
-		interval = 30 * time.Second
-	}
-
-	tk := time.NewTicker(interval)
-	defer tk.Stop()
+// byKey returns a session for the row of id in table.
+// Get, Has and Delete all look rows up with it.
+func (s *Store) byKey(ctx context.Context, table, id string) *xorm.Session {
+	return s.Sql.engine.Context(ctx).Table(table).Where("id = ?", id)
+}
 
-	for {
-		<-tk.C
-		s.GC()
+// newItem creates an item bound to the store's current table.
+// The table is resolved with the store's Partition and Clock, so Split isn't set.
+func (s *Store) newItem() *Item {
+	return &Item{
+		Table: s.partitionTable(s.clock.Now()),
 	}
 }
 
 // options are the options for the mssql store.
 type Options struct {
-	User      string
-	Pwd       string
-	Host      string
-	Db        string
+	User string
+	Pwd  string
+	// Host is the address of the server, optionally with the port, e.g. "db.example.com:1433".
+	Host string
+	Db   string
+	// Instance is the name of the SQL Server instance on Host.
+	// Optional ("" by default).
+	Instance string
+	// Port of the server, it replaces a port in Host.
+	// Optional (the port in Host, or 1433, by default).
+	Port int
+	// Encrypt is the encryption of the connection.
+	// Optional (EncryptDisable by default).
+	Encrypt Encrypt
+	// TrustServerCertificate accepts any certificate of the server, without verifying it.
+	// Optional (false by default).
+	TrustServerCertificate bool
+	// Certificate is the path of a file with the CA certificates that the server's certificate is verified with.
+	// Optional (the system's CAs by default).
+	Certificate string
+	// HostNameInCertificate is the host name that the server's certificate must be issued for.
+	// Optional (Host by default).
+	HostNameInCertificate string
+	// AppName is the application name the connections report to the server.
+	// Optional ("" by default).
+	AppName string
+	// ConnTimeout is the timeout for establishing a connection, in whole seconds.
+	// Optional (no timeout by default).
+	ConnTimeout time.Duration
+	// DSN is a complete connection string of github.com/denisenkom/go-mssqldb.
+	// If it is set, the connection options above are ignored.
+	// Optional ("" by default).
+	DSN string
+	// MaxOpenConns is the maximum number of open connections to the database.
+	// Optional (20 by default).
+	MaxOpenConns int
+	// MaxIdleConns is the maximum number of idle connections that are kept open.
+	// Optional (10 by default).
+	MaxIdleConns int
+	// ConnMaxLifetime is the maximum time a connection is reused.
+	// Optional (unlimited by default).
+	ConnMaxLifetime time.Duration
+	// ConnMaxIdleTime is the maximum time a connection is kept idle.
+	// Optional (unlimited by default).
+	ConnMaxIdleTime time.Duration
+
 	Codec     encoding.Codec
 	Interval  time.Duration
 	TableName string
-	Split     bool
+	// Split partitions the store by time into one table per Partition.
+	// Writes go to the table of the current partition, reads fall back to older ones.
+	Split bool
+	// Partition is the time span of a table of a split store.
+	// Optional (PartitionDay by default).
+	Partition Partition
+	// FallbackPartitions is the number of partitions before the current one that reads of a split store look at,
+	// so that e.g. a key written at 23:59 is still found at 00:01.
+	// GC moves the unexpired rows of the oldest fallback partition and older ones into the current one,
+	// so the rows that expire within the fallback partitions are never moved; keys in older partitions
+	// are only found again once GC has moved them. More fallback partitions mean fewer moves but more tables per read.
+	// Optional (1 by default).
+	FallbackPartitions int
+	// Clock tells the time that selects the partition of a split store.
+	// Expiry is always computed with the database's clock.
+	// Optional (gokv.SystemClock by default).
+	Clock gokv.Clock
+	// DisableAutoGC turns off the periodic deletion of expired rows every Interval.
+	// Expired rows are still never returned, and GC can be called manually.
+	// Optional (false by default).
+	DisableAutoGC bool
+	// OnGC is called with the results of every auto GC pass.
+	// Optional (nil by default).
+	OnGC func(gokv.GCStats)
+	// GCBatchSize is the maximum number of rows deleted by a single statement of the GC.
+	// Optional (1000 by default).
+	GCBatchSize int
+	// Logger receives the store's log messages, e.g. the results of the auto GC passes,
+	// migrations and dropped partition tables.
+	// Optional (gokv.NopLogger by default).
+	Logger gokv.Logger
+	// ShowSQL logs every executed SQL statement with its arguments to Logger at gokv.LevelInfo.
+	// The arguments include the stored data, so it is meant for debugging.
+	// Optional (false by default).
+	ShowSQL bool
+	// KeyLength is the length of the id column of new tables, at most 900.
+	// Optional (64 by default).
+	KeyLength int
+	// HashLongKeys makes the store accept keys longer than KeyLength.
+	// Such a key is stored as its prefix followed by "~" and the base64 encoded SHA-256 hash of the full key,
+	// which requires a KeyLength of at least 45. Keys and Entries return the stored form.
+	// Without it, longer keys are rejected with gokv.ErrKeyTooLong.
+	// Optional (false by default).
+	HashLongKeys bool
+	// AutoMigrate makes NewE migrate the existing tables to the current schema, see Store.Migrate.
+	// Optional (false by default).
+	AutoMigrate bool
+	// HealthCheck makes NewE ping the database,
+	// so that a wrong address or login is reported right away instead of by the first operation.
+	// Optional (false by default).
+	HealthCheck bool
 }
 
 var DefaultOptions = Options{
-	Codec:     encoding.JSON,
-	Interval:  30 * time.Second,
-	TableName: "gokv_test",
-	Split:     false,
+	Codec:        encoding.JSON,
+	Interval:     30 * time.Second,
+	TableName:    "gokv_test",
+	Split:        false,
+	MaxOpenConns: _defMaxOpenConns,
+	MaxIdleConns: _defMaxIdleConns,
 }
 
 // New create a mssql connection.
+// It returns nil if the store can't be created, use NewE to get the cause.
 func New(options Options) *Store {
+	s, err := NewE(options)
+	if err != nil {
+		return nil
+	}
+	return s
+}
+
+// NewE is like New, but returns the error that prevented the store from being created.
+func NewE(options Options) (*Store, error) {
 	if options.Codec == nil {
 		options.Codec = DefaultOptions.Codec
 	}
@@ -185,25 +369,98 @@ func New(options Options) *Store {
 		options.TableName = DefaultOptions.TableName
 	}
 
-	sql := newSqlSvr(options.User, options.Pwd, options.Host, options.Db, options.TableName, options.Split)
-	if sql == nil {
-		return nil
+	if options.FallbackPartitions <= 0 {
+		options.FallbackPartitions = 1
+	}
+	if options.Clock == nil {
+		options.Clock = gokv.SystemClock
+	}
+	if options.Logger == nil {
+		options.Logger = gokv.NopLogger
+	}
+
+	if options.KeyLength == 0 {
+		options.KeyLength = _defKeyLength
+	}
+	if options.KeyLength < 0 || options.KeyLength > _maxKeyLength {
+		return nil, fmt.Errorf("mssql: KeyLength %d is out of range, the maximum is %d", options.KeyLength, _maxKeyLength)
+	}
+	if options.HashLongKeys && options.KeyLength <= len(_keyHashSep)+_keyHashLen {
+		return nil, fmt.Errorf("mssql: KeyLength %d is too short for HashLongKeys, the minimum is %d",
+			options.KeyLength, len(_keyHashSep)+_keyHashLen+1)
+	}
+
+	if options.MaxOpenConns <= 0 {
+		options.MaxOpenConns = DefaultOptions.MaxOpenConns
+	}
+	if options.MaxIdleConns <= 0 {
+		options.MaxIdleConns = DefaultOptions.MaxIdleConns
+	}
+
+	sql, err := newSqlSvr(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.GCBatchSize <= 0 {
+		options.GCBatchSize = _defGCBatchSize
 	}
 
 	s := &Store{
-		Sql:   sql,
-		Codec: options.Codec,
+		Sql:         sql,
+		Codec:       options.Codec,
+		gcBatchSize: options.GCBatchSize,
+
+		keyLength:    options.KeyLength,
+		hashLongKeys: options.HashLongKeys,
+		dialect:      sqlServer{},
+
+		partition:          options.Partition,
+		fallbackPartitions: options.FallbackPartitions,
+		clock:              options.Clock,
+
+		logger: options.Logger,
+	}
+
+	if options.HealthCheck {
+		if err := s.Ping(); err != nil {
+			s.Close()
+			return nil, fmt.Errorf("mssql: health check of host=%s, db=%s failed: %w", options.Host, options.Db, err)
+		}
 	}
 
-	//go s.autoGC(options.Interval)
+	if options.AutoMigrate {
+		if err := s.Migrate(); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
 
-	return s
+	// Without Split, this creates the only table of the store.
+	if _, err := s.table(); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("mssql: can't create table %s: %w", options.TableName, err)
+	}
+
+	if !options.DisableAutoGC {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.gcCancel = cancel
+		s.gcDone = make(chan struct{})
+		go s.autoGC(ctx, options.Interval, options.OnGC)
+	}
+
+	return s, nil
+}
+
+// Ping checks that the database can be reached with the store's login.
+func (s *Store) Ping() error {
+	return wrapErr(s.Sql.engine.Ping())
 }
 
 //Item identifes a cached piece of data
 type Item struct {
 	Key       string    `xorm:"varchar(64) not null pk id"`
-	Data      string    `xorm:"varchar(256) not null data"`
+	Data      string    `xorm:"nvarchar(max) not null data"`
 	ExpiresAt time.Time `xorm:"datetime expiresAt"`
 	CTime     time.Time `xorm:"updated ctime"`
 	Table     string    `xorm:"-"`
@@ -220,6 +477,9 @@ func (i *Item) IsExpired() bool {
 	return time.Now().After(i.ExpiresAt)
 }
 
+// TableName returns the name of the table of the item for xorm.
+// With Split, the current day in local time is appended, which is only the table of a store
+// with the default Partition and Clock; the items of a store have their partition table as Table instead.
 func (i *Item) TableName() string {
 	tbn := i.Table
 	if i.Split {
@@ -1,48 +1,39 @@
 package mssql
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"time"
 
-	mssql "github.com/denisenkom/go-mssqldb"
 	"github.com/go-xorm/xorm"
 )
 
+// Insert inserts the row of data, which must be an *Item, or replaces it if it exists.
+// The table of data must already exist, the store creates it.
+//
+// Deprecated: Use Store.Set, which also computes the expiry with the database's clock.
 func Insert(engine *xorm.Engine, data interface{}) error {
-	_, err := engine.InsertOne(data)
-	if err != nil {
-		//log.Println("mssql: Insert, err=", err)
-		return insertOrUpdate(engine, err, data)
-	}
-	return err
+	return InsertContext(context.Background(), engine, data)
 }
 
-func insertOrUpdate(engine *xorm.Engine, err error, data interface{}) error {
-	e1, ok := err.(mssql.Error)
+// InsertContext is like Insert, but runs the statement with ctx.
+// item.ExpiresAt is turned into the time left until it by the app's clock,
+// and the row expires after that time by the database's clock, like rows written by the store.
+func InsertContext(ctx context.Context, engine *xorm.Engine, data interface{}) error {
+	item, ok := data.(*Item)
 	if !ok {
-		return err
-	}
-
-	errNum := e1.SQLErrorNumber()
-
-	if errNum != 208 && errNum != 2627 {
-		log.Println("mssql: insertOrUpdate, errnum=", errNum)
-		return err
+		return fmt.Errorf("mssql: Insert of %T, only *Item is supported", data)
 	}
 
-	//insert
-	if errNum == 208 {
-		if e2 := engine.CreateTables(data); e2 != nil {
-			return e2
+	expiresAt := expiresAtExpr(0)
+	if !item.ExpiresAt.IsZero() {
+		if expires := time.Until(item.ExpiresAt); expires > 0 {
+			expiresAt = expiresAtExpr(expires)
+		} else {
+			// An expiry in the past stores a row that is already expired.
+			expiresAt = "DATEADD(millisecond, -1, " + _now + ")"
 		}
-		_, e3 := engine.InsertOne(data)
-		return e3
-
-	} else if errNum == 2627 {
-		//update
-		d, _ := data.(*Item)
-		_, e3 := engine.Where("id = ?", d.Key).Cols("expiresAt", "data").Update(d)
-		return e3
 	}
-
-	return nil
+	_, err := engine.Context(ctx).Exec(sqlServer{}.upsert(item.TableName(), expiresAt), item.Key, item.Data)
+	return wrapErr(err)
 }
@@ -0,0 +1,199 @@
+package mssql
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Partition is the time span covered by one table of a split store.
+// The name of a table is the table name followed by the start of its span in the local time of the clock.
+type Partition int
+
+const (
+	// PartitionDay splits by day, the tables are named like gokv20060102.
+	PartitionDay Partition = iota
+	// PartitionHour splits by hour, the tables are named like gokv2006010215.
+	PartitionHour
+	// PartitionMonth splits by month, the tables are named like gokv200601.
+	PartitionMonth
+)
+
+// layout returns the time layout of the suffix of the partition's table names.
+func (p Partition) layout() string {
+	switch p {
+	case PartitionHour:
+		return "2006010215"
+	case PartitionMonth:
+		return "200601"
+	default:
+		return "20060102"
+	}
+}
+
+// start returns the start of the span that contains t.
+func (p Partition) start(t time.Time) time.Time {
+	switch p {
+	case PartitionHour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case PartitionMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+}
+
+// prev returns the start of the span before the one that starts at t.
+func (p Partition) prev(t time.Time) time.Time {
+	switch p {
+	case PartitionHour:
+		return p.start(t.Add(-time.Hour))
+	case PartitionMonth:
+		return t.AddDate(0, -1, 0)
+	default:
+		return t.AddDate(0, 0, -1)
+	}
+}
+
+// partitionTable returns the name of the table for the span that contains t,
+// the table name itself if the store isn't split.
+func (s *Store) partitionTable(t time.Time) string {
+	if !s.Sql.split {
+		return s.Sql.table
+	}
+	return s.Sql.table + t.Format(s.partition.layout())
+}
+
+// isPartitionTable reports whether name is the name of a partition table of the store,
+// and if so returns the start of its span.
+func (s *Store) isPartitionTable(name string) (time.Time, bool) {
+	suffix := strings.TrimPrefix(name, s.Sql.table)
+	if suffix == name || len(suffix) != len(s.partition.layout()) {
+		return time.Time{}, false
+	}
+	start, err := time.ParseInLocation(s.partition.layout(), suffix, s.clock.Now().Location())
+	return start, err == nil
+}
+
+// readTables returns the existing tables that reads look at, the current one first,
+// followed by the FallbackPartitions tables before it.
+// The current table is created if it doesn't exist yet.
+func (s *Store) readTables() ([]string, error) {
+	table, err := s.table()
+	if err != nil {
+		return nil, err
+	}
+	tables := []string{table}
+	if !s.Sql.split {
+		return tables, nil
+	}
+
+	t := s.partition.start(s.clock.Now())
+	for i := 0; i < s.fallbackPartitions; i++ {
+		t = s.partition.prev(t)
+		old := s.partitionTable(t)
+		exists, err := s.exists(old)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			tables = append(tables, old)
+		}
+	}
+	return tables, nil
+}
+
+// exists reports whether table exists.
+// The answer is cached, a table that is dropped by GC or created by table updates the cache.
+func (s *Store) exists(table string) (bool, error) {
+	if exists, ok := s.known.Load(table); ok {
+		return exists.(bool), nil
+	}
+	rows, err := s.Sql.engine.QueryString("SELECT OBJECT_ID(?, N'U') AS id", quoteTable(table))
+	if err != nil {
+		return false, wrapErr(err)
+	}
+	exists := len(rows) == 1 && rows[0]["id"] != ""
+	s.known.Store(table, exists)
+	return exists, nil
+}
+
+// eachTable calls fn with the tables that reads look at, the current one first, until fn is done.
+// Tables that were dropped by GC in the meantime are skipped.
+func (s *Store) eachTable(fn func(table string) (done bool, err error)) error {
+	tables, err := s.readTables()
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		done, err := fn(table)
+		if isMissingTable(err) {
+			s.known.Store(table, false)
+			continue
+		}
+		if err != nil || done {
+			return err
+		}
+	}
+	return nil
+}
+
+// retryMissing calls fn, which writes to the current table, and calls it once more if the table doesn't exist.
+// The table is known to exist after it was created, but the GC of an instance whose clock is ahead
+// might have dropped it as an old table. It is forgotten, so that it is created again.
+func (s *Store) retryMissing(fn func() error) error {
+	err := fn()
+	if isMissingTable(err) {
+		s.known.Delete(s.partitionTable(s.clock.Now()))
+		err = fn()
+	}
+	return err
+}
+
+// deleteOlder deletes the rows of ids from the tables before the current one,
+// so that they don't reappear when the rows of the current table expire.
+func (s *Store) deleteOlder(ctx context.Context, tables []string, ids []string) error {
+	for _, table := range tables[1:] {
+		for _, chunk := range chunkKeys(ids, _maxBatchKeys) {
+			_, err := s.Sql.engine.Context(ctx).Table(table).In("id", chunk).Delete(s.newItem())
+			if isMissingTable(err) {
+				// Dropped by GC in the meantime.
+				s.known.Store(table, false)
+				break
+			}
+			if err != nil {
+				return wrapErr(err)
+			}
+		}
+	}
+	return nil
+}
+
+// promote moves the unexpired row of id from an older table into the current one,
+// unless the current table has a row of id, and deletes id from the older tables.
+// Operations that modify a row call it first, so that they only need to look at the current table.
+// It returns the current table.
+func (s *Store) promote(ctx context.Context, id string) (string, error) {
+	tables, err := s.readTables()
+	if err != nil {
+		return "", err
+	}
+
+	current := quoteTable(tables[0])
+	for _, table := range tables[1:] {
+		old := quoteTable(table)
+		// The locks of the NOT EXISTS keep concurrent promotions of id from inserting it twice.
+		_, err := s.Sql.engine.Context(ctx).Exec("INSERT INTO "+current+" (id, data, expiresAt, ctime)"+
+			" SELECT id, data, expiresAt, ctime FROM "+old+" WHERE id = ? AND ("+_notExpired+")"+
+			" AND NOT EXISTS (SELECT 1 FROM "+current+" WITH (UPDLOCK, HOLDLOCK) WHERE id = ?);"+
+			" DELETE FROM "+old+" WHERE id = ?", id, id, id)
+		if isMissingTable(err) {
+			s.known.Store(table, false)
+			continue
+		}
+		if err != nil {
+			return "", wrapErr(err)
+		}
+	}
+	return tables[0], nil
+}
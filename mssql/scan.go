@@ -0,0 +1,97 @@
+package mssql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yifeng01/gokv"
+	"github.com/yifeng01/gokv/util"
+)
+
+// Keys returns the next page of keys that start with prefix, in ascending key order.
+// Pages are read with WHERE id LIKE ? and keyset pagination on the primary key.
+// Pass "" as cursor to start; an empty next cursor means the iteration is complete.
+// Expired rows are skipped, hashed keys (see Options.HashLongKeys) are returned in their stored form.
+func (s *Store) Keys(prefix, cursor string, count int) (keys []string, next string, err error) {
+	items, next, err := s.scan(prefix, cursor, count, "id")
+	if err != nil {
+		return nil, "", wrapErr(err)
+	}
+
+	keys = make([]string, len(items))
+	for i, item := range items {
+		keys[i] = item.Key
+	}
+	return keys, next, nil
+}
+
+// Entries returns the next page of key-value pairs whose keys start with prefix, in ascending key order.
+// newValue must return a pointer that a value is unmarshalled into.
+// Expired rows are skipped.
+func (s *Store) Entries(prefix, cursor string, count int, newValue func() interface{}) (entries []gokv.KeyValue, next string, err error) {
+	items, next, err := s.scan(prefix, cursor, count, "id", "data")
+	if err != nil {
+		return nil, "", wrapErr(err)
+	}
+
+	entries = make([]gokv.KeyValue, 0, len(items))
+	for _, item := range items {
+		v := newValue()
+		if err := s.unmarshal([]byte(item.Data), v); err != nil {
+			return nil, "", err
+		}
+		entries = append(entries, gokv.KeyValue{Key: item.Key, Value: v})
+	}
+	return entries, next, nil
+}
+
+// scan selects the given columns of the next page of unexpired rows.
+// With Split, the rows of the partitions that reads look at are combined,
+// a key that is in several of them is taken from the newest.
+func (s *Store) scan(prefix, cursor string, count int, cols ...string) (items []*Item, next string, err error) {
+	if count <= 0 {
+		count = util.DefaultScanCount
+	}
+
+	tables, err := s.readTables()
+	if err != nil {
+		return nil, "", err
+	}
+
+	where := `id LIKE ? ESCAPE '\' AND (` + _notExpired + ")"
+	if cursor != "" {
+		where += " AND id > ?"
+	}
+	var selects []string
+	var args []interface{}
+	for i, table := range tables {
+		selects = append(selects, fmt.Sprintf("SELECT %s, %d AS age FROM %s WHERE %s",
+			strings.Join(cols, ", "), i, quoteTable(table), where))
+		args = append(args, escapeLike(prefix)+"%")
+		if cursor != "" {
+			args = append(args, cursor)
+		}
+	}
+	query := fmt.Sprintf("SELECT %s FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY id ORDER BY age) AS n FROM (%s) AS u) AS r"+
+		" WHERE n = 1 ORDER BY id OFFSET 0 ROWS FETCH NEXT %d ROWS ONLY",
+		strings.Join(cols, ", "), strings.Join(selects, " UNION ALL "), count)
+
+	rows, err := s.Sql.engine.QueryString(append([]interface{}{query}, args...)...)
+	if err != nil {
+		return nil, "", wrapErr(err)
+	}
+
+	items = make([]*Item, len(rows))
+	for i, row := range rows {
+		items[i] = &Item{Key: row["id"], Data: row["data"]}
+	}
+	if len(items) == count {
+		next = items[count-1].Key
+	}
+	return items, next, nil
+}
+
+// escapeLike escapes the special characters of a LIKE pattern using '\' as escape character.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`, `[`, `\[`).Replace(s)
+}
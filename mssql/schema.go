@@ -0,0 +1,195 @@
+package mssql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-xorm/xorm"
+
+	"github.com/yifeng01/gokv"
+	"github.com/yifeng01/gokv/encoding"
+)
+
+const (
+	// _defKeyLength is the default length of the id column.
+	_defKeyLength = 64
+	// _maxKeyLength is the maximum size of a clustered index key in SQL Server.
+	_maxKeyLength = 900
+	// _keyHashLen is the length of a base64 encoded SHA-256 hash without padding.
+	_keyHashLen = 43
+	// _keyHashSep separates the kept prefix of a hashed key from its hash.
+	_keyHashSep = "~"
+)
+
+// dataType returns the type of the data column.
+// JSON is stored as text, so that it stays readable and counters can be incremented in SQL,
+// the output of all other codecs as binary.
+func (s *Store) dataType() string {
+	if _, ok := s.Codec.(encoding.JSONcodec); ok {
+		return "nvarchar(max)"
+	}
+	return "varbinary(max)"
+}
+
+// dataArg returns encoded data as an argument of the data column's type,
+// SQL Server doesn't convert between text and binary implicitly.
+func (s *Store) dataArg(data []byte) interface{} {
+	if _, ok := s.Codec.(encoding.JSONcodec); ok {
+		return string(data)
+	}
+	return data
+}
+
+// id returns the value of the id column for k.
+// A key longer than the column is replaced by its prefix and a hash of the full key if HashLongKeys is set,
+// otherwise it is rejected with gokv.ErrKeyTooLong.
+func (s *Store) id(k string) (string, error) {
+	if len(k) <= s.keyLength {
+		return k, nil
+	}
+	if !s.hashLongKeys {
+		return "", fmt.Errorf("mssql: key of %d bytes, the maximum is %d: %w", len(k), s.keyLength, gokv.ErrKeyTooLong)
+	}
+
+	sum := sha256.Sum256([]byte(k))
+	prefix := k[:s.keyLength-len(_keyHashSep)-_keyHashLen]
+	return prefix + _keyHashSep + base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// ids is like id for several keys.
+func (s *Store) ids(keys []string) ([]string, error) {
+	ids := make([]string, len(keys))
+	for i, k := range keys {
+		id, err := s.id(k)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// table returns the name of the store's current table, which is created the first time it's returned.
+// Without Split this happens in NewE, with Split once for every partition.
+func (s *Store) table() (string, error) {
+	table := s.partitionTable(s.clock.Now())
+	if exists, ok := s.known.Load(table); ok && exists.(bool) {
+		return table, nil
+	}
+	if err := s.createTable(table); err != nil {
+		return "", err
+	}
+	s.known.Store(table, true)
+	return table, nil
+}
+
+// createTable creates table with the store's schema if it doesn't exist yet.
+func (s *Store) createTable(table string) error {
+	_, err := s.Sql.engine.Exec(s.dialect.createTable(table, s.keyLength, s.dataType()))
+	return wrapErr(err)
+}
+
+// insert inserts the row of id into table with a raw statement,
+// xorm can't combine the data argument with the expiry expression.
+// The row expires after expires, 0 means never expire.
+func (s *Store) insert(session *xorm.Session, table, id string, data []byte, expires time.Duration) error {
+	_, err := session.Exec("INSERT INTO "+quoteTable(table)+" (id, data, expiresAt, ctime)"+
+		" VALUES (?, ?, "+expiresAtExpr(expires)+", "+_now+")", id, s.dataArg(data))
+	return err
+}
+
+// Migrate changes the columns of all existing tables of the store to the store's schema.
+// The data column gets the type required by the codec, its values are converted,
+// and the id column is widened to Options.KeyLength.
+// Each table is migrated in its own transaction, tables that already have the schema are left as they are.
+func (s *Store) Migrate() error {
+	ctx := context.Background()
+	tables, err := s.tables(ctx)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		if err := s.migrateTable(ctx, table); err != nil {
+			return fmt.Errorf("mssql: migrating table %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// migrateTable migrates one table, see Migrate.
+func (s *Store) migrateTable(ctx context.Context, table string) error {
+	session := s.Sql.engine.NewSession().Context(ctx)
+	// Close rolls the transaction back if it wasn't committed.
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return wrapErr(err)
+	}
+
+	columns, err := session.QueryString(
+		"SELECT COLUMN_NAME AS name, DATA_TYPE AS type, CHARACTER_MAXIMUM_LENGTH AS length"+
+			" FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_NAME = ? AND COLUMN_NAME IN ('id', 'data')", table)
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	qt := quoteTable(table)
+	for _, column := range columns {
+		// The length of a max type is reported as -1.
+		length, _ := strconv.Atoi(column["length"])
+		switch column["name"] {
+		case "id":
+			if length >= s.keyLength {
+				continue
+			}
+			if err := s.widenID(session, table); err != nil {
+				return err
+			}
+			s.logger.Log(gokv.LevelInfo, "mssql: widened id column", "table", table, "length", s.keyLength)
+		case "data":
+			if column["type"]+"(max)" == s.dataType() && length == -1 {
+				continue
+			}
+			// The type can't always be changed in place, so the values are copied to a new column.
+			stmts := [][]interface{}{
+				{fmt.Sprintf("ALTER TABLE %s ADD data_new %s NULL", qt, s.dataType())},
+				{fmt.Sprintf("UPDATE %s SET data_new = CONVERT(%s, data)", qt, s.dataType())},
+				{fmt.Sprintf("ALTER TABLE %s DROP COLUMN data", qt)},
+				{"EXEC sp_rename ?, N'data', N'COLUMN'", qt + ".data_new"},
+				{fmt.Sprintf("ALTER TABLE %s ALTER COLUMN data %s NOT NULL", qt, s.dataType())},
+			}
+			for _, stmt := range stmts {
+				if _, err := session.Exec(stmt...); err != nil {
+					return wrapErr(err)
+				}
+			}
+			s.logger.Log(gokv.LevelInfo, "mssql: converted data column", "table", table, "type", s.dataType())
+		}
+	}
+
+	return wrapErr(session.Commit())
+}
+
+// widenID changes the length of the id column of table to the store's key length.
+// A primary key column can't be altered, so the primary key is dropped and added again.
+func (s *Store) widenID(session *xorm.Session, table string) error {
+	qt := quoteTable(table)
+	rows, err := session.QueryString(
+		"SELECT name FROM sys.key_constraints WHERE type = 'PK' AND parent_object_id = OBJECT_ID(?)", qt)
+	if err != nil {
+		return wrapErr(err)
+	}
+	if len(rows) == 1 {
+		if _, err := session.Exec(fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", qt, quoteTable(rows[0]["name"]))); err != nil {
+			return wrapErr(err)
+		}
+	}
+	if _, err := session.Exec(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN id varchar(%d) NOT NULL", qt, s.keyLength)); err != nil {
+		return wrapErr(err)
+	}
+	_, err = session.Exec(fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (id)", qt))
+	return wrapErr(err)
+}
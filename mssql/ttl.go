@@ -0,0 +1,85 @@
+package mssql
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/yifeng01/gokv/util"
+)
+
+// TTL returns the time left until k expires, 0 means that k never expires.
+func (s *Store) TTL(k string) (ttl time.Duration, found bool, err error) {
+	if err := util.CheckKey(k); err != nil {
+		return 0, false, err
+	}
+	id, err := s.id(k)
+	if err != nil {
+		return 0, false, err
+	}
+
+	// The time left is computed by the database, so the app server's clock doesn't matter.
+	var rows []map[string]string
+	err = s.eachTable(func(table string) (bool, error) {
+		rows, err = s.Sql.engine.QueryString("SELECT CASE WHEN expiresAt IS NULL THEN 0"+
+			" ELSE DATEDIFF_BIG(microsecond, "+_now+", expiresAt) END AS ttl"+
+			" FROM "+quoteTable(table)+" WHERE id = ? AND ("+_notExpired+")", id)
+		return len(rows) > 0, err
+	})
+	if err != nil || len(rows) == 0 {
+		return 0, false, wrapErr(err)
+	}
+
+	micros, err := strconv.ParseInt(rows[0]["ttl"], 10, 64)
+	if err != nil {
+		return 0, false, wrapErr(err)
+	}
+	return time.Duration(micros) * time.Microsecond, true, nil
+}
+
+// Expire sets k to expire after expires, which must be positive.
+// Only the expiresAt column is updated, the stored data is kept as is.
+func (s *Store) Expire(k string, expires time.Duration) (found bool, err error) {
+	if err := util.CheckExpires(expires); err != nil {
+		return false, err
+	}
+	return s.update(k, "expiresAt", expiresAtExpr(expires))
+}
+
+// Persist removes the expiry of k, so that it never expires.
+// Only the expiresAt column is updated, the stored data is kept as is.
+func (s *Store) Persist(k string) (found bool, err error) {
+	return s.update(k, "expiresAt", "NULL")
+}
+
+// Touch sets the ctime column of k to the database time.
+func (s *Store) Touch(k string) (found bool, err error) {
+	return s.update(k, "ctime", _now)
+}
+
+// update sets column of the unexpired row of k to the SQL expression expr.
+func (s *Store) update(k, column, expr string) (found bool, err error) {
+	if err := util.CheckKey(k); err != nil {
+		return false, err
+	}
+	id, err := s.id(k)
+	if err != nil {
+		return false, err
+	}
+
+	var n int64
+	err = s.retryMissing(func() error {
+		table, err := s.promote(context.Background(), id)
+		if err != nil {
+			return err
+		}
+		n, err = s.Sql.engine.Table(table).
+			Where("id = ?", id).And(_notExpired).SetExpr(column, expr).
+			Update(map[string]interface{}{})
+		return wrapErr(err)
+	})
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
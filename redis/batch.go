@@ -0,0 +1,150 @@
+package redis
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+
+	"github.com/yifeng01/gokv/util"
+)
+
+// SetMulti stores all key-value pairs of m in a single pipelined round trip.
+// Every key expires after expires, 0 means never expire.
+// No key may be "" and no value may be nil.
+// With HashMode structs are stored as hashes, like by SetEx.
+func (c *Store) SetMulti(m map[string]interface{}, expires time.Duration) error {
+	if len(m) == 0 {
+		return nil
+	}
+
+	data := make(map[string]string, len(m))
+	hashes := make(map[string]map[string]interface{})
+	for k, v := range m {
+		if err := util.CheckKeyAndValue(k, v); err != nil {
+			return err
+		}
+		fields, ok, err := c.hashFields(v)
+		if err != nil {
+			return err
+		}
+		if ok {
+			hashes[c.key(k)] = fields
+			continue
+		}
+		b, err := c.marshal(v)
+		if err != nil {
+			return err
+		}
+		data[c.key(k)] = string(b)
+	}
+
+	pipe := c.c.Pipeline()
+	defer pipe.Close()
+	keys := make([]string, 0, len(m))
+	for key, value := range data {
+		pipe.Set(key, value, expires)
+		keys = append(keys, key)
+	}
+	for key, fields := range hashes {
+		setHash(pipe, key, fields, expires)
+		keys = append(keys, key)
+	}
+	_, err := pipe.Exec()
+	c.invalidate(keys...)
+	return wrapErr(err)
+}
+
+// GetMulti retrieves the values for the given keys with a single MGET.
+// newValue must return a pointer that a found value is unmarshalled into.
+// With HashMode the keys that are hashes are then read with HGETALL in one pipelined round trip,
+// if newValue returns a pointer to a struct.
+// The returned map only contains the keys that were found.
+func (c *Store) GetMulti(keys []string, newValue func() interface{}) (map[string]interface{}, error) {
+	if len(keys) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	redisKeys := make([]string, len(keys))
+	for i, k := range keys {
+		if err := util.CheckKey(k); err != nil {
+			return nil, err
+		}
+		redisKeys[i] = c.key(k)
+	}
+
+	values, err := c.c.MGet(redisKeys...).Result()
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	hashes, err := c.getHashes(redisKeys, values, newValue)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]interface{}, len(keys))
+	for i, v := range hashes {
+		result[keys[i]] = v
+	}
+	for i, value := range values {
+		// MGET returns nil for missing keys and strings otherwise.
+		dataString, ok := value.(string)
+		if !ok {
+			continue
+		}
+		v := newValue()
+		if err := c.unmarshal([]byte(dataString), v); err != nil {
+			return nil, err
+		}
+		result[keys[i]] = v
+	}
+	return result, nil
+}
+
+// HasMulti reports for each of the given keys whether it exists,
+// with one EXISTS per key in a single pipelined round trip.
+func (c *Store) HasMulti(keys []string) (map[string]bool, error) {
+	for _, k := range keys {
+		if err := util.CheckKey(k); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make(map[string]bool, len(keys))
+	if len(keys) == 0 {
+		return result, nil
+	}
+
+	pipe := c.c.Pipeline()
+	defer pipe.Close()
+	exists := make([]*redis.IntCmd, len(keys))
+	for i, k := range keys {
+		exists[i] = pipe.Exists(c.key(k))
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return nil, wrapErr(err)
+	}
+	for i, k := range keys {
+		result[k] = exists[i].Val() == 1
+	}
+	return result, nil
+}
+
+// DeleteMulti deletes the stored values for the given keys with a single DEL.
+// Deleting non-existing key-value pairs does NOT lead to an error.
+func (c *Store) DeleteMulti(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	redisKeys := make([]string, len(keys))
+	for i, k := range keys {
+		if err := util.CheckKey(k); err != nil {
+			return err
+		}
+		redisKeys[i] = c.key(k)
+	}
+
+	err := c.c.Del(redisKeys...).Err()
+	c.invalidate(redisKeys...)
+	return wrapErr(err)
+}
@@ -0,0 +1,92 @@
+package redis
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+
+	"github.com/yifeng01/gokv/util"
+)
+
+// compareAndSwapScript sets KEYS[1] to ARGV[2] if its value is ARGV[1],
+// keeping its remaining time to live.
+var compareAndSwapScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl > 0 then
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ttl)
+else
+	redis.call("SET", KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// SetNX stores v for k only if k doesn't exist, using SET with the NX option.
+// k expires after expires, 0 means never expire.
+// It reports whether v was stored.
+// With HashMode it returns an error for structs, which SetNX can't store as hash.
+func (c *Store) SetNX(k string, v interface{}, expires time.Duration) (stored bool, err error) {
+	if err := util.CheckKeyAndValue(k, v); err != nil {
+		return false, err
+	}
+	if _, ok, err := c.hashFields(v); err != nil || ok {
+		if err == nil {
+			err = errHashValue("SetNX", v)
+		}
+		return false, err
+	}
+
+	data, err := c.marshal(v)
+	if err != nil {
+		return false, err
+	}
+
+	key := c.key(k)
+	stored, err = c.c.SetNX(key, string(data), expires).Result()
+	if stored || err != nil {
+		c.invalidate(key)
+	}
+	return stored, wrapErr(err)
+}
+
+// CompareAndSwap stores new for k only if the stored value of k encodes to the same bytes as old.
+// The comparison and the write are done atomically by a Lua script, which keeps the expiry of k.
+// It reports whether new was stored.
+// With HashMode it returns an error for structs, since hashes can't be compared and swapped as a whole.
+func (c *Store) CompareAndSwap(k string, old, new interface{}) (swapped bool, err error) {
+	if err := util.CheckKeyAndValue(k, old); err != nil {
+		return false, err
+	}
+	if err := util.CheckVal(new); err != nil {
+		return false, err
+	}
+	for _, v := range []interface{}{old, new} {
+		if _, ok, err := c.hashFields(v); err != nil || ok {
+			if err == nil {
+				err = errHashValue("CompareAndSwap", v)
+			}
+			return false, err
+		}
+	}
+
+	oldData, err := c.marshal(old)
+	if err != nil {
+		return false, err
+	}
+	newData, err := c.marshal(new)
+	if err != nil {
+		return false, err
+	}
+
+	key := c.key(k)
+	n, err := compareAndSwapScript.Run(c.c, []string{key}, string(oldData), string(newData)).Int64()
+	if n == 1 || err != nil {
+		c.invalidate(key)
+	}
+	if err != nil {
+		return false, wrapErr(err)
+	}
+	return n == 1, nil
+}
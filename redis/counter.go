@@ -0,0 +1,84 @@
+package redis
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+
+	"github.com/yifeng01/gokv/encoding"
+	"github.com/yifeng01/gokv/util"
+)
+
+// Incr adds delta to the integer stored for k and returns the new value.
+// A missing or expired k starts at 0.
+// If ttl > 0 the expiry of k is set to ttl, otherwise the current expiry is kept.
+//
+// With the JSON codec, whose encoding of an integer is what Redis stores for counters,
+// INCRBY and PEXPIRE are sent in one MULTI/EXEC pipeline.
+// Other codecs read, decode and write the value in a WATCH transaction,
+// which is retried when the key is changed concurrently.
+// Counters are always strings, also with HashMode; Incr fails for a key that holds a hash.
+func (c *Store) Incr(k string, delta int64, ttl time.Duration) (int64, error) {
+	if err := util.CheckKey(k); err != nil {
+		return 0, err
+	}
+
+	key := c.key(k)
+	defer c.invalidate(key)
+	if _, ok := c.codec.(encoding.JSONcodec); ok {
+		pipe := c.c.TxPipeline()
+		defer pipe.Close()
+		incr := pipe.IncrBy(key, delta)
+		if ttl > 0 {
+			pipe.PExpire(key, ttl)
+		}
+		if _, err := pipe.Exec(); err != nil {
+			return 0, wrapErr(err)
+		}
+		return incr.Val(), nil
+	}
+
+	for {
+		n, err := c.incrWatched(key, delta, ttl)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		return n, wrapErr(err)
+	}
+}
+
+// incrWatched adds delta to the value of key in a WATCH transaction.
+func (c *Store) incrWatched(key string, delta int64, ttl time.Duration) (n int64, err error) {
+	err = c.c.Watch(func(tx *redis.Tx) error {
+		dataString, err := tx.Get(key).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if err == nil {
+			if err := c.unmarshal([]byte(dataString), &n); err != nil {
+				return err
+			}
+		}
+		n += delta
+
+		if ttl <= 0 {
+			// Keep the current expiry, PTTL replies a negative value if there is none.
+			if ttl, err = tx.PTTL(key).Result(); err != nil {
+				return err
+			}
+			if ttl < 0 {
+				ttl = 0
+			}
+		}
+
+		data, err := c.marshal(n)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+			return pipe.Set(key, string(data), ttl).Err()
+		})
+		return err
+	}, key)
+	return n, err
+}
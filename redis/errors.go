@@ -0,0 +1,51 @@
+package redis
+
+import (
+	"errors"
+	"io"
+	"net"
+
+	"github.com/yifeng01/gokv"
+	"github.com/yifeng01/gokv/util"
+)
+
+// The go-redis pool errors are internal, so they can only be recognized by their messages.
+const (
+	_errMsgClosed      = "redis: client is closed"
+	_errMsgPoolTimeout = "redis: connection pool timeout"
+	// Returned by a failover client that can't ask any Sentinel for the master.
+	_errMsgNoSentinel = "redis: all sentinels are unreachable"
+)
+
+// wrapErr maps go-redis errors onto the gokv errors.
+// Connection failures make the store unavailable,
+// errors replied by the server are reported as gokv.ErrBackend.
+func wrapErr(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var netErr net.Error
+	switch {
+	case err.Error() == _errMsgClosed:
+		return util.WrapError(gokv.ErrClosed, err)
+	case err.Error() == _errMsgPoolTimeout,
+		err.Error() == _errMsgNoSentinel,
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.As(err, &netErr):
+		return util.WrapError(gokv.ErrBackendUnavailable, err)
+	}
+	return util.WrapError(gokv.ErrBackend, err)
+}
+
+// marshal encodes v with the store's codec.
+func (c *Store) marshal(v interface{}) ([]byte, error) {
+	data, err := c.codec.Marshal(v)
+	return data, util.WrapError(gokv.ErrCodec, err)
+}
+
+// unmarshal decodes data into v with the store's codec.
+func (c *Store) unmarshal(data []byte, v interface{}) error {
+	return util.WrapError(gokv.ErrCodec, c.codec.Unmarshal(data, v))
+}
@@ -0,0 +1,227 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+
+	"github.com/yifeng01/gokv/util"
+)
+
+// structFields returns the exported fields of the struct that v is or points to, by their hash field names.
+// The name of a field is its Go name, or the name in its `redis:"name"` tag. Fields tagged `redis:"-"` are skipped.
+// It reports false if v isn't a struct or a pointer to one.
+func structFields(v interface{}) (fields map[string]reflect.Value, ok bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, false
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	fields = make(map[string]reflect.Value)
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag := f.Tag.Get("redis"); tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		fields[name] = rv.Field(i)
+	}
+	return fields, true
+}
+
+// destFields returns the fields of the struct that v points to, which a hash can be read into.
+// It reports false if v isn't a pointer to a struct.
+func destFields(v interface{}) (fields map[string]reflect.Value, ok bool) {
+	if reflect.ValueOf(v).Kind() != reflect.Ptr {
+		return nil, false
+	}
+	return structFields(v)
+}
+
+// hashFields encodes the fields of v with the codec if v is stored as a hash, see Options.HashMode.
+// It reports false if v isn't stored as a hash.
+func (c *Store) hashFields(v interface{}) (fields map[string]interface{}, ok bool, err error) {
+	if !c.hashMode {
+		return nil, false, nil
+	}
+	values, ok := structFields(v)
+	if !ok {
+		return nil, false, nil
+	}
+	if len(values) == 0 {
+		return nil, false, fmt.Errorf("redis: %T has no exported fields to store as hash", v)
+	}
+
+	fields = make(map[string]interface{}, len(values))
+	for name, value := range values {
+		data, err := c.marshal(value.Interface())
+		if err != nil {
+			return nil, false, err
+		}
+		fields[name] = string(data)
+	}
+	return fields, true, nil
+}
+
+// setHash queues replacing key with a hash of fields that expires after expires.
+func setHash(pipe redis.Pipeliner, key string, fields map[string]interface{}, expires time.Duration) {
+	pipe.Del(key)
+	pipe.HMSet(key, fields)
+	if expires > 0 {
+		pipe.PExpire(key, expires)
+	}
+}
+
+// getHash reads the hash of key into the struct that v points to.
+// Fields that the hash doesn't have are left as they are.
+// A key that was stored as a string, e.g. before HashMode was enabled, is decoded as a whole.
+func (c *Store) getHash(cmd redis.Cmdable, key string, v interface{}, fields map[string]reflect.Value) (found bool, err error) {
+	hash, err := cmd.HGetAll(key).Result()
+	if isWrongType(err) {
+		dataString, err := cmd.Get(key).Result()
+		if err == redis.Nil {
+			return false, nil
+		}
+		if err != nil {
+			return false, wrapErr(err)
+		}
+		return true, c.unmarshal([]byte(dataString), v)
+	}
+	if err != nil {
+		return false, wrapErr(err)
+	}
+	// A missing key is an empty hash.
+	if len(hash) == 0 {
+		return false, nil
+	}
+
+	return true, c.decodeHash(hash, fields)
+}
+
+// decodeHash unmarshals the fields of hash into the struct fields with the same names.
+func (c *Store) decodeHash(hash map[string]string, fields map[string]reflect.Value) error {
+	for name, dataString := range hash {
+		field, ok := fields[name]
+		if !ok {
+			continue
+		}
+		if err := c.unmarshal([]byte(dataString), field.Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getHashes reads the hashes among redisKeys, for which values, the reply of MGET, is nil.
+// It returns the values of the hashes that exist by their index in redisKeys.
+// Nothing is read if HashMode is off or newValue doesn't return a pointer to a struct.
+func (c *Store) getHashes(redisKeys []string, values []interface{}, newValue func() interface{}) (map[int]interface{}, error) {
+	if !c.hashMode {
+		return nil, nil
+	}
+	if _, ok := destFields(newValue()); !ok {
+		return nil, nil
+	}
+
+	pipe := c.c.Pipeline()
+	defer pipe.Close()
+	cmds := make(map[int]*redis.StringStringMapCmd)
+	for i, value := range values {
+		// MGET returns nil for missing keys and for keys that aren't strings.
+		if value == nil {
+			cmds[i] = pipe.HGetAll(redisKeys[i])
+		}
+	}
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+	// A key that was set to a string since the MGET fails with WRONGTYPE, which is checked per command.
+	if _, err := pipe.Exec(); err != nil && !isWrongType(err) {
+		return nil, wrapErr(err)
+	}
+
+	result := make(map[int]interface{}, len(cmds))
+	for i, cmd := range cmds {
+		hash, err := cmd.Result()
+		if isWrongType(err) || (err == nil && len(hash) == 0) {
+			continue
+		}
+		if err != nil {
+			return nil, wrapErr(err)
+		}
+		v := newValue()
+		fields, _ := destFields(v)
+		if err := c.decodeHash(hash, fields); err != nil {
+			return nil, err
+		}
+		result[i] = v
+	}
+	return result, nil
+}
+
+// errHashValue is the error of the operations that can't store v as a hash, see Options.HashMode.
+func errHashValue(op string, v interface{}) error {
+	return fmt.Errorf("redis: %s doesn't support hashes, but %T is a hash with HashMode", op, v)
+}
+
+// GetField retrieves the value of one field of the hash stored for k, see Options.HashMode.
+// If k or the field doesn't exist it returns (false, nil).
+func (c *Store) GetField(k, field string, v interface{}) (found bool, err error) {
+	if err := util.CheckKeyAndValue(k, v); err != nil {
+		return false, err
+	}
+	if field == "" {
+		return false, errors.New("redis: the field must not be empty")
+	}
+
+	dataString, err := c.c.HGet(c.key(k), field).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, wrapErr(err)
+	}
+	return true, c.unmarshal([]byte(dataString), v)
+}
+
+// SetField stores v in one field of the hash stored for k, without rewriting the other fields.
+// The expiry of k is kept. If k doesn't exist, a hash that never expires is created.
+func (c *Store) SetField(k, field string, v interface{}) error {
+	if err := util.CheckKeyAndValue(k, v); err != nil {
+		return err
+	}
+	if field == "" {
+		return errors.New("redis: the field must not be empty")
+	}
+
+	data, err := c.marshal(v)
+	if err != nil {
+		return err
+	}
+
+	key := c.key(k)
+	err = c.c.HSet(key, field, string(data)).Err()
+	c.invalidate(key)
+	return wrapErr(err)
+}
+
+// isWrongType reports whether err is, or wraps, the reply to a command for another type of value.
+func isWrongType(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "WRONGTYPE")
+}
@@ -0,0 +1,267 @@
+package redis
+
+import (
+	"container/list"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+
+	"github.com/yifeng01/gokv"
+	"github.com/yifeng01/gokv/gomap"
+)
+
+// NearCacheOptions are the options of the near cache of a Store, see Options.NearCache.
+type NearCacheOptions struct {
+	// Size is the maximum number of keys that are kept locally,
+	// the least recently used key is evicted to make room for another one.
+	// Optional (10000 by default).
+	Size int
+	// TTL is the maximum time a value is kept locally.
+	// It bounds how long a stale value can be read if an invalidation gets lost.
+	// Optional (1 minute by default).
+	TTL time.Duration
+	// Channel is the Redis channel that invalidations are published on.
+	// All stores that share keys must use the same channel.
+	// Optional (KeyPrefix + ":invalidate" by default).
+	Channel string
+}
+
+// NearCacheStats are the metrics of the near cache of a Store.
+type NearCacheStats struct {
+	// Hits is the number of reads that were answered locally.
+	Hits int64
+	// Misses is the number of reads that went to Redis.
+	Misses int64
+	// Evictions is the number of keys that were evicted to stay within the size.
+	Evictions int64
+	// Invalidations is the number of keys that were evicted because they were changed,
+	// by this or another store.
+	Invalidations int64
+	// Size is the number of keys that are kept locally.
+	Size int
+}
+
+// HitRatio returns the share of reads that were answered locally, 0 if there were none.
+func (s NearCacheStats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// nearCache is the in-process copy of the values of a Store.
+// It holds the values of Redis keys as gomap items, in least recently used order.
+type nearCache struct {
+	size    int
+	ttl     time.Duration
+	channel string
+	// Identifies the invalidations of this cache, which it has already applied.
+	origin string
+
+	lock  sync.Mutex
+	items map[string]*list.Element
+	// The values are *nearEntry, the most recently used first.
+	lru *list.List
+	// Incremented by every invalidation,
+	// so that a value read from Redis before an invalidation isn't kept.
+	gen   uint64
+	stats NearCacheStats
+
+	pubsub *redis.PubSub
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+type nearEntry struct {
+	key  string
+	item *gomap.Item
+}
+
+// newNearCache creates a near cache with a random origin, which must not be shared with another cache.
+func newNearCache(options NearCacheOptions) (*nearCache, error) {
+	origin := make([]byte, 8)
+	if _, err := rand.Read(origin); err != nil {
+		return nil, fmt.Errorf("redis: can't create the origin of the near cache: %w", err)
+	}
+	return &nearCache{
+		size:    options.Size,
+		ttl:     options.TTL,
+		channel: options.Channel,
+		origin:  hex.EncodeToString(origin),
+		items:   make(map[string]*list.Element),
+		lru:     list.New(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// get returns the data of key if it is kept and not expired.
+func (n *nearCache) get(key string) (data []byte, ok bool) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	elem, ok := n.items[key]
+	if !ok {
+		n.stats.Misses++
+		return nil, false
+	}
+	entry := elem.Value.(*nearEntry)
+	if entry.item.IsExpired() {
+		n.remove(elem)
+		n.stats.Misses++
+		return nil, false
+	}
+	n.lru.MoveToFront(elem)
+	n.stats.Hits++
+	return entry.item.Data, true
+}
+
+// generation returns the current generation, which is passed to add.
+func (n *nearCache) generation() uint64 {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.gen
+}
+
+// add keeps data for key, expiring after ttl (0 means with the cache's TTL).
+// Nothing is kept if there was an invalidation since gen was taken,
+// the data might have been read before it.
+func (n *nearCache) add(key string, data []byte, ttl time.Duration, gen uint64) {
+	if ttl <= 0 || ttl > n.ttl {
+		ttl = n.ttl
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if gen != n.gen {
+		return
+	}
+
+	entry := &nearEntry{key: key, item: &gomap.Item{Data: data, ExpiresAt: time.Now().Add(ttl)}}
+	if elem, ok := n.items[key]; ok {
+		elem.Value = entry
+		n.lru.MoveToFront(elem)
+		return
+	}
+	n.items[key] = n.lru.PushFront(entry)
+	for n.lru.Len() > n.size {
+		n.remove(n.lru.Back())
+		n.stats.Evictions++
+	}
+}
+
+// evict removes the given keys because they were changed.
+func (n *nearCache) evict(keys ...string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.gen++
+	for _, key := range keys {
+		if elem, ok := n.items[key]; ok {
+			n.remove(elem)
+			n.stats.Invalidations++
+		}
+	}
+}
+
+// clear removes all keys, because invalidations might have been missed.
+func (n *nearCache) clear() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.gen++
+	n.stats.Invalidations += int64(len(n.items))
+	n.items = make(map[string]*list.Element)
+	n.lru.Init()
+}
+
+// remove removes the entry of elem, the lock must be held.
+func (n *nearCache) remove(elem *list.Element) {
+	n.lru.Remove(elem)
+	delete(n.items, elem.Value.(*nearEntry).key)
+}
+
+// listen evicts the keys that are published on the channel until close is called.
+// Invalidations can be missed while the subscription is down, so the cache is cleared when it is (re)established.
+func (n *nearCache) listen(logger gokv.Logger) {
+	defer close(n.done)
+	for {
+		msg, err := n.pubsub.Receive()
+		if err != nil {
+			select {
+			case <-n.stop:
+				return
+			default:
+			}
+			n.clear()
+			logger.Log(gokv.LevelWarn, "redis: near cache subscription failed", "channel", n.channel, "err", err)
+			// The subscription is re-established by the next Receive, after a pause.
+			select {
+			case <-n.stop:
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		n.handle(msg)
+	}
+}
+
+// handle applies a message received on the channel.
+// The invalidations of this cache are skipped, they were applied when they were published.
+func (n *nearCache) handle(msg interface{}) {
+	switch msg := msg.(type) {
+	case *redis.Subscription:
+		n.clear()
+	case *redis.Message:
+		// The payload is the origin followed by a space and the key.
+		i := strings.IndexByte(msg.Payload, ' ')
+		if i >= 0 && msg.Payload[:i] != n.origin {
+			n.evict(msg.Payload[i+1:])
+		}
+	}
+}
+
+// close stops listening and waits until listen has returned.
+func (n *nearCache) close() error {
+	close(n.stop)
+	err := n.pubsub.Close()
+	<-n.done
+	return err
+}
+
+// NearCacheStats returns the metrics of the near cache, zero if it isn't enabled.
+func (c *Store) NearCacheStats() NearCacheStats {
+	if c.near == nil {
+		return NearCacheStats{}
+	}
+	c.near.lock.Lock()
+	defer c.near.lock.Unlock()
+	stats := c.near.stats
+	stats.Size = len(c.near.items)
+	return stats
+}
+
+// invalidate evicts the given Redis keys from the near cache of every store on the channel.
+// It is called after every write, also a failed one, since it might have taken effect.
+// A failed publish is only logged, so that it doesn't hide the result of the write.
+func (c *Store) invalidate(keys ...string) {
+	if c.near == nil || len(keys) == 0 {
+		return
+	}
+	c.near.evict(keys...)
+
+	_, err := c.c.Pipelined(func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Publish(c.near.channel, c.near.origin+" "+key)
+		}
+		return nil
+	})
+	if err != nil {
+		c.logger.Log(gokv.LevelWarn, "redis: near cache invalidation failed", "channel", c.near.channel, "err", err)
+	}
+}
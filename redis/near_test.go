@@ -0,0 +1,123 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+func newTestNearCache(t *testing.T, size int) *nearCache {
+	t.Helper()
+	n, err := newNearCache(NearCacheOptions{Size: size, TTL: time.Minute, Channel: "gokv:invalidate"})
+	if err != nil {
+		t.Fatalf("newNearCache: err=%v", err)
+	}
+	return n
+}
+
+func TestNearCache_lru(t *testing.T) {
+	n := newTestNearCache(t, 2)
+	n.add("a", []byte("1"), 0, n.generation())
+	n.add("b", []byte("2"), 0, n.generation())
+	// a is now used more recently than b.
+	if data, ok := n.get("a"); !ok || string(data) != "1" {
+		t.Errorf("get: a, ok=%v, data=%q", ok, data)
+	}
+	n.add("c", []byte("3"), 0, n.generation())
+
+	if _, ok := n.get("b"); ok {
+		t.Error("get: least recently used key b wasn't evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := n.get(key); !ok {
+			t.Errorf("get: %s was evicted", key)
+		}
+	}
+	if n.stats.Evictions != 1 || len(n.items) != 2 || n.lru.Len() != 2 {
+		t.Errorf("stats=%+v, items=%d, lru=%d", n.stats, len(n.items), n.lru.Len())
+	}
+
+	// Replacing a kept key doesn't evict another one.
+	n.add("a", []byte("4"), 0, n.generation())
+	if data, ok := n.get("a"); !ok || string(data) != "4" || n.stats.Evictions != 1 {
+		t.Errorf("get: replaced a, ok=%v, data=%q, stats=%+v", ok, data, n.stats)
+	}
+}
+
+func TestNearCache_ttl(t *testing.T) {
+	n := newTestNearCache(t, 10)
+	n.add("a", []byte("1"), time.Millisecond, n.generation())
+	// A longer TTL than the cache's is capped.
+	n.add("b", []byte("2"), time.Hour, n.generation())
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := n.get("a"); ok {
+		t.Error("get: expired key a was returned")
+	}
+	if elem, ok := n.items["b"]; !ok || time.Until(elem.Value.(*nearEntry).item.ExpiresAt) > time.Minute {
+		t.Errorf("b: kept=%v, TTL isn't capped", ok)
+	}
+}
+
+func TestNearCache_generation(t *testing.T) {
+	n := newTestNearCache(t, 10)
+
+	// A value read before an invalidation isn't kept, it might be stale.
+	gen := n.generation()
+	n.evict("other")
+	n.add("a", []byte("1"), 0, gen)
+	if _, ok := n.get("a"); ok {
+		t.Error("get: value of an old generation was kept")
+	}
+
+	n.add("a", []byte("1"), 0, n.generation())
+	gen = n.generation()
+	n.clear()
+	if _, ok := n.get("a"); ok || n.generation() == gen || n.stats.Invalidations != 1 {
+		t.Errorf("clear: ok=%v, gen=%d, stats=%+v", ok, n.generation(), n.stats)
+	}
+}
+
+func TestNearCache_handle(t *testing.T) {
+	n := newTestNearCache(t, 10)
+	other := newTestNearCache(t, 10)
+	if n.origin == other.origin || len(n.origin) != 16 {
+		t.Errorf("origin=%q, other origin=%q", n.origin, other.origin)
+	}
+
+	for _, key := range []string{"a", "b", "c d"} {
+		n.add(key, []byte(key), 0, n.generation())
+	}
+	tests := []struct {
+		name    string
+		payload string
+		kept    []string
+		evicted []string
+	}{
+		{name: "own invalidation", payload: n.origin + " a", kept: []string{"a", "b", "c d"}},
+		{name: "payload without origin", payload: "a", kept: []string{"a", "b", "c d"}},
+		{name: "other store", payload: other.origin + " a", kept: []string{"b", "c d"}, evicted: []string{"a"}},
+		{name: "key with a space", payload: other.origin + " c d", kept: []string{"b"}, evicted: []string{"c d"}},
+	}
+	for _, test := range tests {
+		n.handle(&redis.Message{Channel: n.channel, Payload: test.payload})
+		for _, key := range test.kept {
+			if _, ok := n.items[key]; !ok {
+				t.Errorf("%s: %s was evicted", test.name, key)
+			}
+		}
+		for _, key := range test.evicted {
+			if _, ok := n.items[key]; ok {
+				t.Errorf("%s: %s was kept", test.name, key)
+			}
+		}
+	}
+
+	// Invalidations might have been missed while the subscription was down.
+	gen := n.generation()
+	n.handle(&redis.Subscription{Kind: "subscribe", Channel: n.channel})
+	if len(n.items) != 0 || n.lru.Len() != 0 || n.generation() == gen {
+		t.Errorf("subscription: items=%d, gen=%d", len(n.items), n.generation())
+	}
+}
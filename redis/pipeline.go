@@ -0,0 +1,231 @@
+package redis
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis"
+
+	"github.com/yifeng01/gokv/encoding"
+	"github.com/yifeng01/gokv/util"
+)
+
+// ErrTxFailed is returned by Store.Tx when a watched key was changed before the transaction was executed.
+// None of the queued operations took effect, the transaction can be retried.
+var ErrTxFailed = errors.New("redis: transaction failed, a watched key was changed")
+
+// Pipeliner queues operations of a Store, which are sent to Redis together.
+// Keys are transformed with the store's KeyFn and values are encoded with its codec, as by the Store itself.
+// The operations take effect when the pipeline or transaction is executed, after its function has returned.
+type Pipeliner interface {
+	// Set queues storing v for k.
+	Set(k string, v interface{}) error
+	// SetEx queues storing v for k, expiring after expires.
+	SetEx(k string, v interface{}, expires time.Duration) error
+	// Delete queues deleting k.
+	Delete(k string) error
+	// Incr queues adding delta to the integer stored for k, as Store.Incr does.
+	// The new value can be read from the result once executed.
+	// Only the JSON codec stores integers in a form that Redis can increment, other codecs are rejected.
+	Incr(k string, delta int64, ttl time.Duration) (*IncrResult, error)
+}
+
+// IncrResult is the result of an Incr queued in a Pipeliner.
+type IncrResult struct {
+	cmd *redis.IntCmd
+}
+
+// Value returns the new value of the counter.
+// It fails if the pipeline or transaction hasn't been executed, or if the increment failed.
+func (r *IncrResult) Value() (int64, error) {
+	if r.cmd == nil {
+		return 0, errors.New("redis: the Incr hasn't been executed")
+	}
+	n, err := r.cmd.Result()
+	return n, wrapErr(err)
+}
+
+// pipeline is the Pipeliner of Pipeline and Tx.
+// It records the operations, so that they can be queued in the go-redis pipeline when it is executed.
+type pipeline struct {
+	store *Store
+	ops   []func(pipe redis.Pipeliner)
+	// The Redis keys that the operations change, for the near cache.
+	keys []string
+}
+
+func (p *pipeline) Set(k string, v interface{}) error {
+	return p.SetEx(k, v, 0)
+}
+
+func (p *pipeline) SetEx(k string, v interface{}, expires time.Duration) error {
+	if err := util.CheckKeyAndValue(k, v); err != nil {
+		return err
+	}
+	key := p.store.key(k)
+	fields, ok, err := p.store.hashFields(v)
+	if err != nil {
+		return err
+	}
+	if ok {
+		p.keys = append(p.keys, key)
+		p.ops = append(p.ops, func(pipe redis.Pipeliner) {
+			setHash(pipe, key, fields, expires)
+		})
+		return nil
+	}
+
+	data, err := p.store.marshal(v)
+	if err != nil {
+		return err
+	}
+
+	p.keys = append(p.keys, key)
+	p.ops = append(p.ops, func(pipe redis.Pipeliner) {
+		pipe.Set(key, string(data), expires)
+	})
+	return nil
+}
+
+func (p *pipeline) Delete(k string) error {
+	if err := util.CheckKey(k); err != nil {
+		return err
+	}
+
+	key := p.store.key(k)
+	p.keys = append(p.keys, key)
+	p.ops = append(p.ops, func(pipe redis.Pipeliner) {
+		pipe.Del(key)
+	})
+	return nil
+}
+
+func (p *pipeline) Incr(k string, delta int64, ttl time.Duration) (*IncrResult, error) {
+	if err := util.CheckKey(k); err != nil {
+		return nil, err
+	}
+	if _, ok := p.store.codec.(encoding.JSONcodec); !ok {
+		return nil, errors.New("redis: Incr in a pipeline requires the JSON codec")
+	}
+
+	key := p.store.key(k)
+	p.keys = append(p.keys, key)
+	result := &IncrResult{}
+	p.ops = append(p.ops, func(pipe redis.Pipeliner) {
+		result.cmd = pipe.IncrBy(key, delta)
+		if ttl > 0 {
+			pipe.PExpire(key, ttl)
+		}
+	})
+	return result, nil
+}
+
+// queue queues the recorded operations in pipe.
+func (p *pipeline) queue(pipe redis.Pipeliner) error {
+	for _, op := range p.ops {
+		op(pipe)
+	}
+	return nil
+}
+
+// Pipeline calls fn to queue operations and sends them to Redis in a single round trip.
+// The operations aren't atomic, other clients' commands can run in between.
+// Nothing is sent if fn returns an error, which is returned.
+// Otherwise the first error of the operations is returned.
+func (c *Store) Pipeline(fn func(p Pipeliner) error) error {
+	p := &pipeline{store: c}
+	if err := fn(p); err != nil {
+		return err
+	}
+	if len(p.ops) == 0 {
+		return nil
+	}
+
+	_, err := c.c.Pipelined(p.queue)
+	c.invalidate(p.keys...)
+	return wrapErr(err)
+}
+
+// Tx is a transaction of a Store, see Store.Tx.
+// It is a Pipeliner whose operations are run atomically in MULTI/EXEC.
+type Tx struct {
+	pipeline
+	// The connection that watches the keys, nil if none are watched.
+	tx *redis.Tx
+}
+
+var _ Pipeliner = (*Tx)(nil)
+
+// Get retrieves the value of k right away, like Store.Get.
+// Reading a watched key and queueing writes that depend on it makes for an optimistic lock.
+func (t *Tx) Get(k string, v interface{}) (found bool, err error) {
+	if err := util.CheckKeyAndValue(k, v); err != nil {
+		return false, err
+	}
+	if t.tx == nil {
+		return false, errors.New("redis: Get in a transaction requires watched keys")
+	}
+
+	dataString, err := t.tx.Get(t.store.key(k)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return false, nil
+		}
+		return false, wrapErr(err)
+	}
+	return true, t.store.unmarshal([]byte(dataString), v)
+}
+
+// Tx calls fn to queue operations and runs them atomically with MULTI/EXEC.
+// Nothing is run if fn returns an error, which is returned.
+//
+// The keys in watch are watched with WATCH before fn is called, fn can read them with Tx.Get.
+// If one of them is changed by someone else before the transaction is executed,
+// none of the operations takes effect and ErrTxFailed is returned, so that the caller can retry.
+// In cluster mode, all keys are in the slot of the store's hash tag, so any keys can be watched together.
+func (c *Store) Tx(fn func(tx *Tx) error, watch ...string) error {
+	if len(watch) == 0 {
+		t := &Tx{pipeline: pipeline{store: c}}
+		if err := fn(t); err != nil {
+			return err
+		}
+		if len(t.ops) == 0 {
+			return nil
+		}
+		_, err := c.c.TxPipelined(t.queue)
+		c.invalidate(t.keys...)
+		return wrapErr(err)
+	}
+
+	keys := make([]string, len(watch))
+	for i, k := range watch {
+		if err := util.CheckKey(k); err != nil {
+			return err
+		}
+		keys[i] = c.key(k)
+	}
+
+	// The error of fn is returned as it is, not as an error of Redis.
+	var fnErr error
+	err := c.c.Watch(func(tx *redis.Tx) error {
+		t := &Tx{pipeline: pipeline{store: c}, tx: tx}
+		if fnErr = fn(t); fnErr != nil {
+			return fnErr
+		}
+		if len(t.ops) == 0 {
+			return nil
+		}
+		_, err := tx.TxPipelined(t.queue)
+		if err != redis.TxFailedErr {
+			c.invalidate(t.keys...)
+		}
+		return err
+	}, keys...)
+	if fnErr != nil {
+		return fnErr
+	}
+	if err == redis.TxFailedErr {
+		return ErrTxFailed
+	}
+	return wrapErr(err)
+}
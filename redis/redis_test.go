@@ -0,0 +1,63 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/go-redis/redis"
+)
+
+func TestNewClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		// The Addr of the client's options, "" for a cluster client.
+		addr    string
+		cluster []string
+	}{
+		{name: "single", options: Options{Addresses: []string{"a:6379"}}, addr: "a:6379"},
+		{name: "sentinel", options: Options{Addresses: []string{"s1:26379", "s2:26379"}, MasterName: "master"}, addr: "FailoverClient"},
+		{name: "cluster", options: Options{Addresses: []string{"a:6379"}, Cluster: true}, cluster: []string{"a:6379"}},
+		{name: "several addresses", options: Options{Addresses: []string{"a:6379", "b:6379"}}, cluster: []string{"a:6379", "b:6379"}},
+	}
+
+	for _, test := range tests {
+		test.options.Password, test.options.DB = "pw", 2
+		client := newClient(test.options)
+		switch c := client.(type) {
+		case *redis.Client:
+			if test.addr == "" || c.Options().Addr != test.addr || c.Options().Password != "pw" || c.Options().DB != 2 {
+				t.Errorf("%s: client options=%+v", test.name, c.Options())
+			}
+		case *redis.ClusterClient:
+			// A cluster only has DB 0.
+			if test.addr != "" || len(c.Options().Addrs) != len(test.cluster) || c.Options().Addrs[0] != test.cluster[0] || c.Options().Password != "pw" {
+				t.Errorf("%s: cluster options=%+v", test.name, c.Options())
+			}
+		default:
+			t.Errorf("%s: client %T", test.name, client)
+		}
+		client.Close()
+	}
+}
+
+func TestStore_key(t *testing.T) {
+	tests := []struct {
+		name  string
+		store Store
+		key   string
+	}{
+		{name: "single", store: Store{keyFn: DefaultKeyFunc, keyPrefix: "gokv"}, key: "gokv:a"},
+		// All keys of a store are in the slot of its prefix, so that they can be used together.
+		{name: "cluster", store: Store{keyFn: DefaultKeyFunc, keyPrefix: "gokv", cluster: true}, key: "{gokv}:a"},
+		{name: "cluster with a custom KeyFn", store: Store{keyFn: func(prefix, s string) string { return prefix + "/" + s }, keyPrefix: "p", cluster: true}, key: "{p}/a"},
+	}
+
+	for _, test := range tests {
+		if key := test.store.key("a"); key != test.key {
+			t.Errorf("%s: key=%q, want %q", test.name, key, test.key)
+		}
+		if k := test.store.unkey(test.key); k != "a" {
+			t.Errorf("%s: unkey=%q", test.name, k)
+		}
+	}
+}
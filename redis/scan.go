@@ -0,0 +1,147 @@
+package redis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis"
+
+	"github.com/yifeng01/gokv"
+	"github.com/yifeng01/gokv/util"
+)
+
+// Keys returns the next page of keys that start with prefix.
+// It uses SCAN with a MATCH pattern instead of KEYS, so it doesn't block the server.
+// As with SCAN, count is only a hint, a page can be empty before the iteration is complete
+// and a key can be returned more than once.
+// Scanning requires a KeyFn that only prepends to the key, like DefaultKeyFunc does.
+// In cluster mode, the node of the store's hash tag is scanned.
+// Expired keys are never returned by Redis.
+func (c *Store) Keys(prefix, cursor string, count int) (keys []string, next string, err error) {
+	redisKeys, next, err := c.scan(prefix, cursor, count)
+	if err != nil {
+		return nil, "", err
+	}
+
+	keys = make([]string, len(redisKeys))
+	for i, redisKey := range redisKeys {
+		keys[i] = c.unkey(redisKey)
+	}
+	return keys, next, nil
+}
+
+// Entries returns the next page of key-value pairs whose keys start with prefix.
+// The keys are scanned like in Keys and their values are fetched with a single MGET.
+// newValue must return a pointer that a value is unmarshalled into.
+func (c *Store) Entries(prefix, cursor string, count int, newValue func() interface{}) (entries []gokv.KeyValue, next string, err error) {
+	redisKeys, next, err := c.scan(prefix, cursor, count)
+	if err != nil || len(redisKeys) == 0 {
+		return nil, next, err
+	}
+
+	values, err := c.c.MGet(redisKeys...).Result()
+	if err != nil {
+		return nil, "", wrapErr(err)
+	}
+	hashes, err := c.getHashes(redisKeys, values, newValue)
+	if err != nil {
+		return nil, "", err
+	}
+
+	entries = make([]gokv.KeyValue, 0, len(values))
+	for i, value := range values {
+		if v, ok := hashes[i]; ok {
+			entries = append(entries, gokv.KeyValue{Key: c.unkey(redisKeys[i]), Value: v})
+			continue
+		}
+		// The key might have expired or been deleted since it was scanned.
+		dataString, ok := value.(string)
+		if !ok {
+			continue
+		}
+		v := newValue()
+		if err := c.unmarshal([]byte(dataString), v); err != nil {
+			return nil, "", err
+		}
+		entries = append(entries, gokv.KeyValue{Key: c.unkey(redisKeys[i]), Value: v})
+	}
+	return entries, next, nil
+}
+
+// scan runs one SCAN step for the Redis keys of all keys starting with prefix.
+func (c *Store) scan(prefix, cursor string, count int) (redisKeys []string, next string, err error) {
+	var redisCursor uint64
+	if cursor != "" {
+		if redisCursor, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			return nil, "", err
+		}
+	}
+	if count <= 0 {
+		count = util.DefaultScanCount
+	}
+
+	match := escapePattern(c.key(prefix)) + "*"
+	if c.cluster {
+		redisKeys, redisCursor, err = c.clusterScan(redisCursor, match, count)
+	} else {
+		redisKeys, redisCursor, err = c.c.Scan(redisCursor, match, int64(count)).Result()
+	}
+	if err != nil {
+		return nil, "", wrapErr(err)
+	}
+
+	// Redis signals the end of the iteration with cursor 0.
+	if redisCursor != 0 {
+		next = strconv.FormatUint(redisCursor, 10)
+	}
+	return redisKeys, next, nil
+}
+
+// _scanScript runs SCAN on the node that holds the slot of KEYS[1].
+var _scanScript = redis.NewScript(`return redis.call('SCAN', ARGV[1], 'MATCH', ARGV[2], 'COUNT', ARGV[3])`)
+
+// clusterScan runs one SCAN step in cluster mode.
+// A cluster client sends SCAN to any node, but all keys of the store are in the slot of its hash tag,
+// so the step is run by a script on the node of that slot.
+func (c *Store) clusterScan(cursor uint64, match string, count int) (redisKeys []string, next uint64, err error) {
+	res, err := _scanScript.Run(c.c, []string{c.key("")}, cursor, match, count).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// The reply is the next cursor followed by the keys, as for SCAN.
+	reply, ok := res.([]interface{})
+	if !ok || len(reply) != 2 {
+		return nil, 0, fmt.Errorf("redis: unexpected SCAN reply %v", res)
+	}
+	cursorString, _ := reply[0].(string)
+	if next, err = strconv.ParseUint(cursorString, 10, 64); err != nil {
+		return nil, 0, err
+	}
+	keys, _ := reply[1].([]interface{})
+	for _, key := range keys {
+		if redisKey, ok := key.(string); ok {
+			redisKeys = append(redisKeys, redisKey)
+		}
+	}
+	return redisKeys, next, nil
+}
+
+// unkey maps a Redis key back to the key it was created from.
+func (c *Store) unkey(redisKey string) string {
+	return strings.TrimPrefix(redisKey, c.key(""))
+}
+
+// escapePattern escapes the glob-style special characters of a SCAN MATCH pattern.
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
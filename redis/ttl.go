@@ -0,0 +1,79 @@
+package redis
+
+import (
+	"time"
+
+	"github.com/yifeng01/gokv/util"
+)
+
+// TTL returns the time left until k expires, 0 means that k never expires.
+// It uses PTTL, so the precision is one millisecond.
+func (c *Store) TTL(k string) (ttl time.Duration, found bool, err error) {
+	if err := util.CheckKey(k); err != nil {
+		return 0, false, err
+	}
+
+	ttl, err = c.c.PTTL(c.key(k)).Result()
+	if err != nil {
+		return 0, false, wrapErr(err)
+	}
+	// PTTL replies -2 if the key doesn't exist and -1 if it has no expiry.
+	switch ttl {
+	case -2 * time.Millisecond:
+		return 0, false, nil
+	case -1 * time.Millisecond:
+		return 0, true, nil
+	}
+	return ttl, true, nil
+}
+
+// Expire sets k to expire after expires, which must be positive.
+// It uses PEXPIRE.
+func (c *Store) Expire(k string, expires time.Duration) (found bool, err error) {
+	if err := util.CheckKey(k); err != nil {
+		return false, err
+	}
+	if err := util.CheckExpires(expires); err != nil {
+		return false, err
+	}
+
+	key := c.key(k)
+	found, err = c.c.PExpire(key, expires).Result()
+	if found || err != nil {
+		// A kept copy could outlive the new expiry.
+		c.invalidate(key)
+	}
+	return found, wrapErr(err)
+}
+
+// Persist removes the expiry of k, so that it never expires.
+// It uses PERSIST, followed by EXISTS in the same transaction,
+// because PERSIST doesn't distinguish a missing key from one without expiry.
+func (c *Store) Persist(k string) (found bool, err error) {
+	if err := util.CheckKey(k); err != nil {
+		return false, err
+	}
+
+	key := c.key(k)
+	pipe := c.c.TxPipeline()
+	defer pipe.Close()
+	pipe.Persist(key)
+	exists := pipe.Exists(key)
+	if _, err := pipe.Exec(); err != nil {
+		return false, wrapErr(err)
+	}
+	return exists.Val() == 1, nil
+}
+
+// Touch updates the last access time of k with TOUCH.
+func (c *Store) Touch(k string) (found bool, err error) {
+	if err := util.CheckKey(k); err != nil {
+		return false, err
+	}
+
+	n, err := c.c.Touch(c.key(k)).Result()
+	if err != nil {
+		return false, wrapErr(err)
+	}
+	return n == 1, nil
+}
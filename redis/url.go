@@ -0,0 +1,142 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// applyURL returns options with the settings of options.URL, see Options.URL.
+// The errors never contain the URL, which might contain a password.
+func applyURL(options Options) (Options, error) {
+	u, err := url.Parse(options.URL)
+	if err != nil {
+		return options, errors.New("redis: the URL can't be parsed")
+	}
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		if options.TLSConfig == nil {
+			options.TLSConfig = &tls.Config{}
+		}
+	default:
+		return options, fmt.Errorf("redis: invalid URL scheme %q, must be redis or rediss", u.Scheme)
+	}
+
+	if u.User != nil {
+		options.Username = u.User.Username()
+		// Without a user name, e.g. redis://:password@host, only the password is sent.
+		options.Password, _ = u.User.Password()
+	}
+
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		host = u.Host
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	if port == "" {
+		port = "6379"
+	}
+	options.Address = net.JoinHostPort(host, port)
+
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if options.DB, err = strconv.Atoi(db); err != nil {
+			return options, fmt.Errorf("redis: invalid DB %q in URL", db)
+		}
+	}
+
+	query := u.Query()
+	if addrs, ok := query["addr"]; ok {
+		options.Addresses = append([]string{options.Address}, addrs...)
+	}
+	if name := query.Get("master_name"); name != "" {
+		options.MasterName = name
+		if len(options.Addresses) == 0 {
+			options.Addresses = []string{options.Address}
+		}
+	}
+	if caFile := query.Get("ca_file"); caFile != "" {
+		options.CAFile = caFile
+	}
+
+	ints := map[string]*int{
+		"pool_size":      &options.PoolSize,
+		"min_idle_conns": &options.MinIdleConns,
+		"max_retries":    &options.MaxRetries,
+	}
+	for name, dest := range ints {
+		if s := query.Get(name); s != "" {
+			if *dest, err = strconv.Atoi(s); err != nil {
+				return options, fmt.Errorf("redis: invalid %s %q in URL", name, s)
+			}
+		}
+	}
+	durations := map[string]*time.Duration{
+		"dial_timeout":      &options.DialTimeout,
+		"read_timeout":      &options.ReadTimeout,
+		"write_timeout":     &options.WriteTimeout,
+		"pool_timeout":      &options.PoolTimeout,
+		"idle_timeout":      &options.IdleTimeout,
+		"min_retry_backoff": &options.MinRetryBackoff,
+		"max_retry_backoff": &options.MaxRetryBackoff,
+	}
+	for name, dest := range durations {
+		if s := query.Get(name); s != "" {
+			if *dest, err = time.ParseDuration(s); err != nil {
+				return options, fmt.Errorf("redis: invalid %s %q in URL", name, s)
+			}
+		}
+	}
+	return options, nil
+}
+
+// tlsConfig returns the TLS configuration of options, nil if TLS isn't used.
+// The certificates of options.CAFile replace the CAs that the server's certificate is verified with.
+func tlsConfig(options Options) (*tls.Config, error) {
+	if options.CAFile == "" {
+		return options.TLSConfig, nil
+	}
+
+	pem, err := os.ReadFile(options.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("redis: can't read CAFile: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("redis: CAFile %s contains no PEM certificates", options.CAFile)
+	}
+
+	config := &tls.Config{}
+	if options.TLSConfig != nil {
+		config = options.TLSConfig.Clone()
+	}
+	config.RootCAs = pool
+	return config, nil
+}
+
+// authACL authenticates new connections as username with AUTH username password (Redis 6),
+// and then selects db.
+// go-redis only sends AUTH with the password, so neither the password nor the DB must be passed to it as well,
+// it would send SELECT before the connection is authenticated.
+func authACL(username, password string, db int) func(conn *redis.Conn) error {
+	return func(conn *redis.Conn) error {
+		if err := conn.Do("AUTH", username, password).Err(); err != nil {
+			return err
+		}
+		if db > 0 {
+			return conn.Select(db).Err()
+		}
+		return nil
+	}
+}
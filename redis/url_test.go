@@ -0,0 +1,299 @@
+package redis
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestApplyURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want Options
+	}{
+		{
+			name: "defaults",
+			url:  "redis://",
+			want: Options{Address: "localhost:6379"},
+		},
+		{
+			name: "password only",
+			url:  "redis://:secret@db:6380/2",
+			want: Options{Address: "db:6380", Password: "secret", DB: 2},
+		},
+		{
+			name: "user and escaped password",
+			url:  "redis://app:p%40ss%2Fw%3Ard@db/0",
+			want: Options{Address: "db:6379", Username: "app", Password: "p@ss/w:rd"},
+		},
+		{
+			name: "tls",
+			url:  "rediss://db?ca_file=/etc/ssl/ca.pem",
+			want: Options{Address: "db:6379", TLSConfig: &tls.Config{}, CAFile: "/etc/ssl/ca.pem"},
+		},
+		{
+			name: "cluster",
+			url:  "redis://a:7000?addr=b:7001&addr=c:7002",
+			want: Options{Address: "a:7000", Addresses: []string{"a:7000", "b:7001", "c:7002"}},
+		},
+		{
+			name: "sentinel",
+			url:  "redis://s1:26379?master_name=mymaster&addr=s2:26379",
+			want: Options{Address: "s1:26379", Addresses: []string{"s1:26379", "s2:26379"}, MasterName: "mymaster"},
+		},
+		{
+			name: "sentinel with one address",
+			url:  "redis://s1:26379?master_name=mymaster",
+			want: Options{Address: "s1:26379", Addresses: []string{"s1:26379"}, MasterName: "mymaster"},
+		},
+		{
+			name: "tuning",
+			url: "redis://[::1]:6379?pool_size=5&min_idle_conns=2&max_retries=3&dial_timeout=1s&read_timeout=2s" +
+				"&write_timeout=3s&pool_timeout=4s&idle_timeout=5m&min_retry_backoff=8ms&max_retry_backoff=512ms",
+			want: Options{Address: "[::1]:6379", PoolSize: 5, MinIdleConns: 2, MaxRetries: 3,
+				DialTimeout: time.Second, ReadTimeout: 2 * time.Second, WriteTimeout: 3 * time.Second,
+				PoolTimeout: 4 * time.Second, IdleTimeout: 5 * time.Minute,
+				MinRetryBackoff: 8 * time.Millisecond, MaxRetryBackoff: 512 * time.Millisecond},
+		},
+	}
+
+	for _, test := range tests {
+		options, err := applyURL(Options{URL: test.url})
+		if err != nil {
+			t.Errorf("%s: err=%v", test.name, err)
+			continue
+		}
+		test.want.URL = test.url
+		if !reflect.DeepEqual(options, test.want) {
+			t.Errorf("%s: options=%+v, want %+v", test.name, options, test.want)
+		}
+	}
+
+	// A TLS configuration of the options is kept.
+	config := &tls.Config{ServerName: "db"}
+	if options, err := applyURL(Options{URL: "rediss://db", TLSConfig: config}); err != nil || options.TLSConfig != config {
+		t.Errorf("TLSConfig: err=%v, config=%+v", err, options.TLSConfig)
+	}
+
+	invalid := []string{
+		"http://user:secret@db",
+		"redis://user:secret@db/x",
+		"redis://user:secret@db?pool_size=x",
+		"redis://user:secret@db?dial_timeout=1",
+		"redis://user:secret@db:6379\x7f",
+	}
+	for _, url := range invalid {
+		if _, err := applyURL(Options{URL: url}); err == nil || strings.Contains(err.Error(), "secret") {
+			t.Errorf("%q: err=%v", url, err)
+		}
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, newCertPEM(t), 0600); err != nil {
+		t.Fatalf("WriteFile: err=%v", err)
+	}
+	noPEM := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(noPEM, []byte("no certificate"), 0600); err != nil {
+		t.Fatalf("WriteFile: err=%v", err)
+	}
+
+	// Without a CAFile the configuration is used as it is.
+	config := &tls.Config{ServerName: "db"}
+	if c, err := tlsConfig(Options{TLSConfig: config}); err != nil || c != config {
+		t.Errorf("without CAFile: err=%v, config=%+v", err, c)
+	}
+	if c, err := tlsConfig(Options{}); err != nil || c != nil {
+		t.Errorf("without TLS: err=%v, config=%+v", err, c)
+	}
+
+	// The CAs replace those of a copy of the configuration.
+	c, err := tlsConfig(Options{TLSConfig: config, CAFile: caFile})
+	if err != nil || c == config || c.ServerName != "db" || c.RootCAs == nil || config.RootCAs != nil {
+		t.Errorf("CAFile: err=%v, config=%+v", err, c)
+	}
+	if c, err := tlsConfig(Options{CAFile: caFile}); err != nil || c == nil || c.RootCAs == nil {
+		t.Errorf("CAFile without TLSConfig: err=%v, config=%+v", err, c)
+	}
+
+	for _, file := range []string{filepath.Join(dir, "missing.pem"), noPEM} {
+		if _, err := tlsConfig(Options{CAFile: file}); err == nil {
+			t.Errorf("%s: err=nil", file)
+		}
+	}
+}
+
+// newCertPEM returns a self-signed certificate in PEM format.
+func newCertPEM(t *testing.T) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: err=%v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gokv test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: err=%v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestNewE_auth(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		want    []string
+	}{
+		{
+			name:    "password",
+			options: Options{Password: "pw", DB: 2},
+			want:    []string{"AUTH pw", "SELECT 2", "PING"},
+		},
+		// SELECT must follow AUTH username password, before it the server rejects it with NOAUTH.
+		{
+			name:    "username",
+			options: Options{Username: "app", Password: "pw", DB: 2},
+			want:    []string{"AUTH app pw", "SELECT 2", "PING"},
+		},
+		{
+			name:    "username with DB 0",
+			options: Options{Username: "app", Password: "pw"},
+			want:    []string{"AUTH app pw", "PING"},
+		},
+		{
+			name:    "url",
+			options: Options{URL: "redis://app:pw@ADDR/3"},
+			want:    []string{"AUTH app pw", "SELECT 3", "PING"},
+		},
+	}
+
+	for _, test := range tests {
+		server := newFakeServer(t)
+		test.options.Address = server.addr
+		test.options.URL = strings.Replace(test.options.URL, "ADDR", server.addr, 1)
+		store, err := NewE(test.options)
+		if err != nil {
+			t.Errorf("%s: NewE: err=%v", test.name, err)
+			continue
+		}
+		store.Close()
+		if commands := server.commands(); !reflect.DeepEqual(commands, test.want) {
+			t.Errorf("%s: commands=%q, want %q", test.name, commands, test.want)
+		}
+	}
+}
+
+// fakeServer is a Redis server that records the commands it receives.
+// It replies to PING with PONG and to every other command with OK.
+type fakeServer struct {
+	addr string
+
+	lock     sync.Mutex
+	received []string
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: err=%v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	s := &fakeServer{addr: l.Addr().String()}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		// go-redis sends the names of some commands in lower case.
+		args[0] = strings.ToUpper(args[0])
+		s.lock.Lock()
+		s.received = append(s.received, strings.Join(args, " "))
+		s.lock.Unlock()
+
+		reply := "+OK\r\n"
+		if args[0] == "PING" {
+			reply = "+PONG\r\n"
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeServer) commands() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.received...)
+}
+
+// readCommand reads a command, which clients send as array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n <= 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(r, arg); err != nil {
+			return nil, err
+		}
+		args[i] = string(arg[:size])
+	}
+	return args, nil
+}
@@ -0,0 +1,46 @@
+package gokv
+
+// KeyValue is a key together with its unmarshalled value.
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+// Scanner is implemented by stores whose keys can be listed.
+// Expired entries are never returned.
+//
+// Iteration is cursor based: pass "" as cursor to start and pass the returned
+// next cursor to the following call. An empty next cursor means the iteration
+// is complete. count is the page size; count <= 0 selects the store's default.
+// Some stores (e.g. Redis) treat count as a hint only,
+// so a page can be empty while the iteration isn't complete yet.
+// Keys that are written or deleted during an iteration may or may not be returned.
+type Scanner interface {
+	// Keys returns the next page of keys that start with prefix.
+	Keys(prefix, cursor string, count int) (keys []string, next string, err error)
+	// Entries returns the next page of key-value pairs whose keys start with prefix.
+	// newValue is called once per entry and must return a pointer
+	// that the stored value is unmarshalled into.
+	Entries(prefix, cursor string, count int, newValue func() interface{}) (entries []KeyValue, next string, err error)
+}
+
+// ForEachKey calls fn for every key of s that starts with prefix,
+// until fn returns false or the iteration is complete.
+func ForEachKey(s Scanner, prefix string, fn func(k string) bool) error {
+	cursor := ""
+	for {
+		keys, next, err := s.Keys(prefix, cursor, 0)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if !fn(k) {
+				return nil
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,193 @@
+package sql
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/yifeng01/gokv/util"
+)
+
+// _maxBatchKeys is the maximum number of keys per IN list,
+// it stays below the parameter limits of all dialects (999 in old SQLite versions).
+const _maxBatchKeys = 500
+
+// SetMulti stores all key-value pairs of m inside one transaction,
+// each with the dialect's upsert statement.
+// Every key expires after expires, 0 means never expire.
+// No key may be "" and no value may be nil.
+func (s *Store) SetMulti(m map[string]interface{}, expires time.Duration) error {
+	if len(m) == 0 {
+		return nil
+	}
+
+	datas := make(map[string][]byte, len(m))
+	for k, v := range m {
+		if err := s.checkKey(k); err != nil {
+			return err
+		}
+		if err := util.CheckVal(v); err != nil {
+			return err
+		}
+		data, err := s.marshal(v)
+		if err != nil {
+			return err
+		}
+		datas[k] = data
+	}
+	if err := s.checkOpen(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapErr(err)
+	}
+	// Rollback does nothing after Commit.
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, s.rebind(s.Dialect.Upsert(s.table, s.expiresAt(expires))))
+	if err != nil {
+		return wrapErr(err)
+	}
+	defer stmt.Close()
+	for k, data := range datas {
+		if _, err := stmt.ExecContext(ctx, k, data); err != nil {
+			return wrapErr(err)
+		}
+	}
+
+	return wrapErr(tx.Commit())
+}
+
+// GetMulti retrieves the values for the given keys with as few SELECT statements as possible.
+// Expired values are reported as not found.
+// newValue must return a pointer that a found value is unmarshalled into.
+// The returned map only contains the keys that were found.
+func (s *Store) GetMulti(keys []string, newValue func() interface{}) (map[string]interface{}, error) {
+	for _, k := range keys {
+		if err := s.checkKey(k); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]interface{}, len(keys))
+	for _, chunk := range chunkKeys(keys, _maxBatchKeys) {
+		rows, err := s.DB.Query(s.rebind("SELECT id, data FROM "+s.Dialect.Quote(s.table)+
+			" WHERE id IN ("+placeholders(len(chunk))+") AND "+s.notExpired()), stringArgs(chunk)...)
+		if err != nil {
+			return nil, wrapErr(err)
+		}
+		for rows.Next() {
+			var k string
+			var data []byte
+			if err := rows.Scan(&k, &data); err != nil {
+				rows.Close()
+				return nil, wrapErr(err)
+			}
+			v := newValue()
+			if err := s.unmarshal(data, v); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			result[k] = v
+		}
+		if err := rows.Close(); err != nil {
+			return nil, wrapErr(err)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, wrapErr(err)
+		}
+	}
+	return result, nil
+}
+
+// HasMulti reports for each of the given keys whether it exists, with as few SELECT statements as possible.
+// Only the ids are selected, the values aren't read. Expired values are reported as not existing.
+func (s *Store) HasMulti(keys []string) (map[string]bool, error) {
+	for _, k := range keys {
+		if err := s.checkKey(k); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		result[k] = false
+	}
+	for _, chunk := range chunkKeys(keys, _maxBatchKeys) {
+		rows, err := s.DB.Query(s.rebind("SELECT id FROM "+s.Dialect.Quote(s.table)+
+			" WHERE id IN ("+placeholders(len(chunk))+") AND "+s.notExpired()), stringArgs(chunk)...)
+		if err != nil {
+			return nil, wrapErr(err)
+		}
+		for rows.Next() {
+			var k string
+			if err := rows.Scan(&k); err != nil {
+				rows.Close()
+				return nil, wrapErr(err)
+			}
+			result[k] = true
+		}
+		if err := rows.Close(); err != nil {
+			return nil, wrapErr(err)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, wrapErr(err)
+		}
+	}
+	return result, nil
+}
+
+// DeleteMulti deletes the stored values for the given keys with as few DELETE statements as possible.
+// Deleting non-existing key-value pairs does NOT lead to an error.
+func (s *Store) DeleteMulti(keys []string) error {
+	for _, k := range keys {
+		if err := s.checkKey(k); err != nil {
+			return err
+		}
+	}
+
+	for _, chunk := range chunkKeys(keys, _maxBatchKeys) {
+		_, err := s.exec(context.Background(), "DELETE FROM "+s.Dialect.Quote(s.table)+
+			" WHERE id IN ("+placeholders(len(chunk))+")", stringArgs(chunk)...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chunkKeys splits keys into slices of at most size keys.
+func chunkKeys(keys []string, size int) [][]string {
+	var chunks [][]string
+	for start := 0; start < len(keys); start += size {
+		end := start + size
+		if end > len(keys) {
+			end = len(keys)
+		}
+		chunks = append(chunks, keys[start:end])
+	}
+	return chunks
+}
+
+// placeholders returns n comma separated "?" placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// stringArgs converts keys into statement arguments.
+func stringArgs(keys []string) []interface{} {
+	args := make([]interface{}, len(keys))
+	for i, k := range keys {
+		args[i] = k
+	}
+	return args
+}
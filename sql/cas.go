@@ -0,0 +1,83 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/yifeng01/gokv/util"
+)
+
+// SetNX stores v for k only if k doesn't exist or is expired.
+// Inside one transaction an expired row of k is deleted,
+// and v is written with the dialect's InsertNX statement, which doesn't touch an existing row.
+// It reports whether v was stored.
+func (s *Store) SetNX(k string, v interface{}, expires time.Duration) (stored bool, err error) {
+	if err := s.checkKey(k); err != nil {
+		return false, err
+	}
+	if err := util.CheckVal(v); err != nil {
+		return false, err
+	}
+	data, err := s.marshal(v)
+	if err != nil {
+		return false, err
+	}
+	if err := s.checkOpen(); err != nil {
+		return false, err
+	}
+
+	ctx := context.Background()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, wrapErr(err)
+	}
+	// Rollback does nothing after Commit.
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, s.rebind("DELETE FROM "+s.Dialect.Quote(s.table)+
+		" WHERE id = ? AND expiresAt <= "+s.Dialect.Now()), k)
+	if err != nil {
+		return false, wrapErr(err)
+	}
+	res, err := tx.ExecContext(ctx, s.rebind(s.Dialect.InsertNX(s.table, s.expiresAt(expires))), k, data)
+	if err != nil {
+		return false, wrapErr(err)
+	}
+	if stored, err = affected(res, 1); err != nil {
+		return false, err
+	}
+
+	return stored, wrapErr(tx.Commit())
+}
+
+// CompareAndSwap stores new for k only if the stored value of k encodes to the same bytes as old.
+// It is a single conditional UPDATE, the data column is binary in all dialects.
+// The expiry of k is kept.
+// It reports whether new was stored.
+func (s *Store) CompareAndSwap(k string, old, new interface{}) (swapped bool, err error) {
+	if err := s.checkKey(k); err != nil {
+		return false, err
+	}
+	if err := util.CheckVal(old); err != nil {
+		return false, err
+	}
+	if err := util.CheckVal(new); err != nil {
+		return false, err
+	}
+
+	oldData, err := s.marshal(old)
+	if err != nil {
+		return false, err
+	}
+	newData, err := s.marshal(new)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := s.exec(context.Background(), "UPDATE "+s.Dialect.Quote(s.table)+" SET data = ?, ctime = "+s.Dialect.Now()+
+		" WHERE id = ? AND data = ? AND "+s.notExpired(), newData, k, oldData)
+	if err != nil {
+		return false, err
+	}
+	return affected(res, 1)
+}
@@ -0,0 +1,87 @@
+package sql
+
+import (
+	"context"
+	"time"
+)
+
+// Incr adds delta to the integer stored for k and returns the new value.
+// A missing or expired k starts at 0.
+// If ttl > 0 the expiry of k is set to ttl, otherwise the current expiry is kept.
+//
+// The data column can't be incremented in SQL for every codec and dialect,
+// so the value is read, incremented and written back with an UPDATE that only matches the value it read,
+// which is retried if another write came in between. A missing key is inserted with the dialect's InsertNX.
+// An UPDATE that leaves the row as it is counts as no affected row in MySQL without clientFoundRows,
+// so a row that still holds the value it was updated to counts as written.
+func (s *Store) Incr(k string, delta int64, ttl time.Duration) (int64, error) {
+	if err := s.checkKey(k); err != nil {
+		return 0, err
+	}
+
+	ctx := context.Background()
+	table := s.Dialect.Quote(s.table)
+	for {
+		var old []byte
+		var live bool
+		found, err := s.scanRow(ctx, "SELECT data, CASE WHEN "+s.notExpired()+" THEN 1 ELSE 0 END"+
+			" FROM "+table+" WHERE id = ?", []interface{}{k}, &old, &live)
+		if err != nil {
+			return 0, err
+		}
+
+		if found && !live {
+			// An expired counter starts over without its expiry, the row is replaced by the insert below.
+			_, err := s.exec(ctx, "DELETE FROM "+table+" WHERE id = ? AND expiresAt <= "+s.Dialect.Now(), k)
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		var n int64
+		if found {
+			if err := s.unmarshal(old, &n); err != nil {
+				return 0, err
+			}
+		}
+		n += delta
+		data, err := s.marshal(n)
+		if err != nil {
+			return 0, err
+		}
+
+		var query string
+		var args []interface{}
+		if !found {
+			query, args = s.Dialect.InsertNX(s.table, s.expiresAt(ttl)), []interface{}{k, data}
+		} else {
+			set := "data = ?, ctime = " + s.Dialect.Now()
+			if ttl > 0 {
+				set += ", expiresAt = " + s.expiresAt(ttl)
+			}
+			query = "UPDATE " + table + " SET " + set + " WHERE id = ? AND data = ? AND " + s.notExpired()
+			args = []interface{}{data, k, old}
+		}
+		res, err := s.exec(ctx, query, args...)
+		if err != nil {
+			return 0, err
+		}
+		written, err := affected(res, 1)
+		if err != nil {
+			return 0, err
+		}
+		if !written && found && delta == 0 {
+			// Nothing changed unless another write came in between, which the value tells.
+			var one int
+			written, err = s.scanRow(ctx, "SELECT 1 FROM "+table+" WHERE id = ? AND data = ? AND "+s.notExpired(),
+				[]interface{}{k, data}, &one)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if written {
+			return n, nil
+		}
+	}
+}
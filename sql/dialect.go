@@ -0,0 +1,206 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dialect supplies the statements whose syntax differs between SQL databases.
+// The store writes statements with "?" as placeholder, they are rebound with Placeholder.
+//
+// Times are stored as milliseconds since the Unix epoch and always taken from the database's clock,
+// so the clocks of the app servers don't matter.
+// expiresAt is NULL for a row that never expires.
+type Dialect interface {
+	// Placeholder returns the placeholder of the n-th argument of a statement, starting at 1.
+	Placeholder(n int) string
+	// Quote quotes a table name.
+	Quote(name string) string
+	// Now returns the expression for the current database time in milliseconds since the Unix epoch.
+	Now() string
+	// Limit returns the clause that follows ORDER BY and limits a SELECT to n rows.
+	Limit(n int) string
+	// CreateTable returns the statement that creates table if it doesn't exist yet.
+	// The id column holds keys of up to keyLength bytes.
+	CreateTable(table string, keyLength int) string
+	// Upsert returns a single atomic statement that inserts the row of a key,
+	// or replaces its data and expiry if it exists.
+	// It takes the id and the data as arguments, expiresAt is the SQL expression for the row's expiry.
+	Upsert(table, expiresAt string) string
+	// InsertNX is like Upsert, but leaves an existing row as it is.
+	// It affects no row if the key exists.
+	InsertNX(table, expiresAt string) string
+	// DeleteExpired returns the statement that deletes at most n expired rows of table.
+	DeleteExpired(table string, n int) string
+}
+
+// The dialects of the supported databases.
+var (
+	// SQLServer is the dialect of SQL Server 2016 and newer, e.g. for github.com/denisenkom/go-mssqldb.
+	// Its placeholders are @p1, @p2, ..., which go-mssqldb only binds if the DB was opened with the
+	// "sqlserver" driver name; with "mssql", as the mssql store uses, every statement fails.
+	SQLServer Dialect = sqlServer{}
+	// Postgres is the dialect of PostgreSQL 9.5 and newer, e.g. for github.com/lib/pq.
+	Postgres Dialect = postgres{}
+	// MySQL is the dialect of MySQL 5.6 and newer, e.g. for github.com/go-sql-driver/mysql.
+	// The DSN must set clientFoundRows=true, otherwise an update that doesn't change a row
+	// isn't counted and e.g. Persist of a key without expiry reports it as not found.
+	MySQL Dialect = mySQL{}
+	// SQLite is the dialect of SQLite 3.24 and newer, e.g. for github.com/mattn/go-sqlite3.
+	SQLite Dialect = sqlite{}
+)
+
+// sqlServer is the dialect of SQL Server.
+type sqlServer struct{}
+
+func (sqlServer) Placeholder(n int) string { return fmt.Sprintf("@p%d", n) }
+
+func (sqlServer) Quote(name string) string {
+	return "[" + strings.Replace(name, "]", "]]", -1) + "]"
+}
+
+func (sqlServer) Now() string { return "DATEDIFF_BIG(millisecond, '19700101', SYSUTCDATETIME())" }
+
+func (sqlServer) Limit(n int) string { return fmt.Sprintf("OFFSET 0 ROWS FETCH NEXT %d ROWS ONLY", n) }
+
+func (d sqlServer) CreateTable(table string, keyLength int) string {
+	return fmt.Sprintf("IF OBJECT_ID(N'%s', N'U') IS NULL CREATE TABLE %s ("+
+		"id varchar(%d) NOT NULL PRIMARY KEY, data varbinary(max) NOT NULL, expiresAt bigint NULL, ctime bigint NULL)",
+		strings.Replace(d.Quote(table), "'", "''", -1), d.Quote(table), keyLength)
+}
+
+// Upsert returns a MERGE statement.
+// HOLDLOCK keeps the range of the key locked between the match and the write,
+// otherwise two sessions could both miss the row and the second insert would fail with a duplicate key.
+func (d sqlServer) Upsert(table, expiresAt string) string {
+	return d.merge(table, expiresAt) +
+		" WHEN MATCHED THEN UPDATE SET data = s.data, expiresAt = s.expiresAt, ctime = s.ctime" +
+		" WHEN NOT MATCHED THEN INSERT (id, data, expiresAt, ctime) VALUES (s.id, s.data, s.expiresAt, s.ctime);"
+}
+
+func (d sqlServer) InsertNX(table, expiresAt string) string {
+	return d.merge(table, expiresAt) +
+		" WHEN NOT MATCHED THEN INSERT (id, data, expiresAt, ctime) VALUES (s.id, s.data, s.expiresAt, s.ctime);"
+}
+
+func (d sqlServer) merge(table, expiresAt string) string {
+	return "MERGE " + d.Quote(table) + " WITH (HOLDLOCK) AS t" +
+		" USING (SELECT ? AS id, ? AS data, " + expiresAt + " AS expiresAt, " + d.Now() + " AS ctime) AS s" +
+		" ON t.id = s.id"
+}
+
+func (d sqlServer) DeleteExpired(table string, n int) string {
+	return fmt.Sprintf("DELETE TOP (%d) FROM %s WHERE expiresAt <= %s", n, d.Quote(table), d.Now())
+}
+
+// postgres is the dialect of PostgreSQL.
+type postgres struct{}
+
+func (postgres) Placeholder(n int) string { return fmt.Sprintf("$%d", n) }
+
+func (postgres) Quote(name string) string { return quoteDouble(name) }
+
+// Now uses clock_timestamp, now() is the start of the transaction.
+func (postgres) Now() string { return "CAST(EXTRACT(EPOCH FROM clock_timestamp()) * 1000 AS bigint)" }
+
+func (postgres) Limit(n int) string { return fmt.Sprintf("LIMIT %d", n) }
+
+func (d postgres) CreateTable(table string, keyLength int) string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+
+		"id varchar(%d) NOT NULL PRIMARY KEY, data bytea NOT NULL, expiresAt bigint NULL, ctime bigint NULL)",
+		d.Quote(table), keyLength)
+}
+
+func (d postgres) Upsert(table, expiresAt string) string {
+	return insertOnConflict(d, table, expiresAt) +
+		" DO UPDATE SET data = EXCLUDED.data, expiresAt = EXCLUDED.expiresAt, ctime = EXCLUDED.ctime"
+}
+
+func (d postgres) InsertNX(table, expiresAt string) string {
+	return insertOnConflict(d, table, expiresAt) + " DO NOTHING"
+}
+
+func (d postgres) DeleteExpired(table string, n int) string { return deleteExpiredByID(d, table, n) }
+
+// mySQL is the dialect of MySQL.
+type mySQL struct{}
+
+func (mySQL) Placeholder(int) string { return "?" }
+
+func (mySQL) Quote(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+func (mySQL) Now() string { return "CAST(UNIX_TIMESTAMP(CURRENT_TIMESTAMP(3)) * 1000 AS SIGNED)" }
+
+func (mySQL) Limit(n int) string { return fmt.Sprintf("LIMIT %d", n) }
+
+// CreateTable uses a binary id column, the default collation would make keys case insensitive.
+func (d mySQL) CreateTable(table string, keyLength int) string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+
+		"id varbinary(%d) NOT NULL PRIMARY KEY, data longblob NOT NULL, expiresAt bigint NULL, ctime bigint NULL)",
+		d.Quote(table), keyLength)
+}
+
+func (d mySQL) Upsert(table, expiresAt string) string {
+	return d.insert("INSERT", table, expiresAt) +
+		" ON DUPLICATE KEY UPDATE data = VALUES(data), expiresAt = VALUES(expiresAt), ctime = VALUES(ctime)"
+}
+
+func (d mySQL) InsertNX(table, expiresAt string) string {
+	return d.insert("INSERT IGNORE", table, expiresAt)
+}
+
+func (d mySQL) insert(verb, table, expiresAt string) string {
+	return verb + " INTO " + d.Quote(table) + " (id, data, expiresAt, ctime) VALUES (?, ?, " + expiresAt + ", " + d.Now() + ")"
+}
+
+func (d mySQL) DeleteExpired(table string, n int) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE expiresAt <= %s LIMIT %d", d.Quote(table), d.Now(), n)
+}
+
+// sqlite is the dialect of SQLite.
+type sqlite struct{}
+
+func (sqlite) Placeholder(int) string { return "?" }
+
+func (sqlite) Quote(name string) string { return quoteDouble(name) }
+
+func (sqlite) Now() string { return "CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)" }
+
+func (sqlite) Limit(n int) string { return fmt.Sprintf("LIMIT %d", n) }
+
+func (d sqlite) CreateTable(table string, keyLength int) string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+
+		"id varchar(%d) NOT NULL PRIMARY KEY, data blob NOT NULL, expiresAt integer NULL, ctime integer NULL)",
+		d.Quote(table), keyLength)
+}
+
+func (d sqlite) Upsert(table, expiresAt string) string {
+	return insertOnConflict(d, table, expiresAt) +
+		" DO UPDATE SET data = excluded.data, expiresAt = excluded.expiresAt, ctime = excluded.ctime"
+}
+
+func (d sqlite) InsertNX(table, expiresAt string) string {
+	return insertOnConflict(d, table, expiresAt) + " DO NOTHING"
+}
+
+func (d sqlite) DeleteExpired(table string, n int) string { return deleteExpiredByID(d, table, n) }
+
+// quoteDouble quotes a name with double quotes, as in standard SQL.
+func quoteDouble(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// insertOnConflict returns the INSERT ... ON CONFLICT (id) statement of PostgreSQL and SQLite
+// without its action.
+func insertOnConflict(d Dialect, table, expiresAt string) string {
+	return "INSERT INTO " + d.Quote(table) + " (id, data, expiresAt, ctime)" +
+		" VALUES (?, ?, " + expiresAt + ", " + d.Now() + ") ON CONFLICT (id)"
+}
+
+// deleteExpiredByID limits a DELETE with a subquery, for databases whose DELETE has no limit.
+func deleteExpiredByID(d Dialect, table string, n int) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE id IN (SELECT id FROM %s WHERE expiresAt <= %s %s)",
+		d.Quote(table), d.Quote(table), d.Now(), d.Limit(n))
+}
@@ -0,0 +1,47 @@
+package sql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/yifeng01/gokv"
+	"github.com/yifeng01/gokv/util"
+)
+
+// database/sql doesn't export this error, so it can only be recognized by its message.
+const _errMsgClosed = "sql: database is closed"
+
+// wrapErr maps database errors onto the gokv errors.
+// Connection failures make the store unavailable, all other errors of the database are reported as gokv.ErrBackend.
+func wrapErr(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var netErr net.Error
+	switch {
+	case err.Error() == _errMsgClosed:
+		return util.WrapError(gokv.ErrClosed, err)
+	case errors.Is(err, driver.ErrBadConn),
+		errors.Is(err, sql.ErrConnDone),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.As(err, &netErr):
+		return util.WrapError(gokv.ErrBackendUnavailable, err)
+	}
+	return util.WrapError(gokv.ErrBackend, err)
+}
+
+// marshal encodes v with the store's codec.
+func (s *Store) marshal(v interface{}) ([]byte, error) {
+	data, err := s.Codec.Marshal(v)
+	return data, util.WrapError(gokv.ErrCodec, err)
+}
+
+// unmarshal decodes data into v with the store's codec.
+func (s *Store) unmarshal(data []byte, v interface{}) error {
+	return util.WrapError(gokv.ErrCodec, s.Codec.Unmarshal(data, v))
+}
@@ -0,0 +1,83 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/yifeng01/gokv"
+	"github.com/yifeng01/gokv/util"
+)
+
+// _defGCBatchSize is the default number of rows deleted per statement by GC.
+const _defGCBatchSize = 1000
+
+// GC deletes the expired rows of the store's table.
+// The rows are deleted in batches of Options.GCBatchSize, each batch in its own statement,
+// so a sweep never holds many locks at once.
+// Only expired rows are visited, so GCStats.Scanned is the same as GCStats.Removed.
+func (s *Store) GC() gokv.GCStats {
+	return s.gc(context.Background())
+}
+
+// gc is like GC, but stops between two batches when ctx is done.
+func (s *Store) gc(ctx context.Context) (stats gokv.GCStats) {
+	start := time.Now()
+	defer func() {
+		stats.Scanned = stats.Removed
+		stats.Duration = time.Since(start)
+	}()
+
+	query := s.Dialect.DeleteExpired(s.table, s.gcBatchSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			stats.Err = err
+			return stats
+		}
+		res, err := s.exec(ctx, query)
+		if err != nil {
+			stats.Err = err
+			return stats
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			stats.Err = wrapErr(err)
+			return stats
+		}
+		stats.Removed += int(n)
+		if n < int64(s.gcBatchSize) {
+			return stats
+		}
+	}
+}
+
+// auto GC
+// It runs until ctx is done, onGC (if not nil) gets the results of every pass.
+func (s *Store) autoGC(ctx context.Context, interval time.Duration, onGC func(gokv.GCStats)) {
+	defer close(s.gcDone)
+
+	tk := time.NewTicker(interval)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tk.C:
+			stats := s.gc(ctx)
+			util.LogGC(s.logger, "sql", stats)
+			if onGC != nil {
+				onGC(stats)
+			}
+		}
+	}
+}
+
+// stopGC stops the auto GC, a running pass is aborted after the current batch,
+// and waits until it has returned.
+func (s *Store) stopGC() {
+	if s.gcCancel == nil {
+		return
+	}
+	s.gcCancel()
+	<-s.gcDone
+}
@@ -0,0 +1,108 @@
+package sql
+
+import (
+	"context"
+	"strings"
+
+	"github.com/yifeng01/gokv"
+	"github.com/yifeng01/gokv/util"
+)
+
+// Keys returns the next page of keys that start with prefix, in ascending key order.
+// Pages are read with WHERE id LIKE ? and keyset pagination on the primary key.
+// Pass "" as cursor to start; an empty next cursor means the iteration is complete.
+// Expired rows are skipped.
+func (s *Store) Keys(prefix, cursor string, count int) (keys []string, next string, err error) {
+	next, err = s.scan(prefix, cursor, count, false, func(k string, _ []byte) error {
+		keys = append(keys, k)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return keys, next, nil
+}
+
+// Entries returns the next page of key-value pairs whose keys start with prefix, in ascending key order.
+// newValue must return a pointer that a value is unmarshalled into.
+// Expired rows are skipped.
+func (s *Store) Entries(prefix, cursor string, count int, newValue func() interface{}) (entries []gokv.KeyValue, next string, err error) {
+	next, err = s.scan(prefix, cursor, count, true, func(k string, data []byte) error {
+		v := newValue()
+		if err := s.unmarshal(data, v); err != nil {
+			return err
+		}
+		entries = append(entries, gokv.KeyValue{Key: k, Value: v})
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return entries, next, nil
+}
+
+// scan calls fn for every row of the next page of unexpired rows, data is nil unless withData is set.
+// LIKE ignores case in some databases, so rows whose id doesn't start with prefix are skipped,
+// a page can hold fewer than count rows before the iteration is complete.
+func (s *Store) scan(prefix, cursor string, count int, withData bool, fn func(k string, data []byte) error) (next string, err error) {
+	if err := s.checkOpen(); err != nil {
+		return "", err
+	}
+	if count <= 0 {
+		count = util.DefaultScanCount
+	}
+
+	cols := "id"
+	if withData {
+		cols = "id, data"
+	}
+	query := "SELECT " + cols + " FROM " + s.Dialect.Quote(s.table) +
+		" WHERE id LIKE ? ESCAPE '!' AND " + s.notExpired()
+	args := []interface{}{escapeLike(prefix) + "%"}
+	if cursor != "" {
+		query += " AND id > ?"
+		args = append(args, cursor)
+	}
+	query += " ORDER BY id " + s.Dialect.Limit(count)
+
+	rows, err := s.DB.QueryContext(context.Background(), s.rebind(query), args...)
+	if err != nil {
+		return "", wrapErr(err)
+	}
+	defer rows.Close()
+
+	n := 0
+	var k string
+	for rows.Next() {
+		n++
+		var data []byte
+		dest := []interface{}{&k}
+		if withData {
+			dest = append(dest, &data)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return "", wrapErr(err)
+		}
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if err := fn(k, data); err != nil {
+			return "", err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", wrapErr(err)
+	}
+
+	if n == count {
+		next = k
+	}
+	return next, nil
+}
+
+// escapeLike escapes the special characters of a LIKE pattern using '!' as escape character,
+// which unlike '\' has no special meaning in the string literals of any dialect.
+// '[' is only special in SQL Server.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`, `[`, `![`).Replace(s)
+}
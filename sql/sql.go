@@ -0,0 +1,334 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/yifeng01/gokv"
+	"github.com/yifeng01/gokv/encoding"
+	"github.com/yifeng01/gokv/util"
+)
+
+// Store is a gokv.Store implementation for any database supported by database/sql.
+// The statements that differ between databases are supplied by its Dialect.
+// All entries are kept in one table with an id, data, expiresAt and ctime column.
+type Store struct {
+	DB      *sql.DB
+	Dialect Dialect
+	Codec   encoding.Codec
+
+	table       string
+	keyLength   int
+	gcBatchSize int
+	logger      gokv.Logger
+	closed      atomic.Bool
+	// For stopping the auto GC, nil if it's disabled.
+	gcCancel context.CancelFunc
+	gcDone   chan struct{}
+}
+
+// Set stores the given value for the given key.
+// Values are automatically marshalled to JSON or gob (depending on the configuration).
+// The key must not be "" and the value must not be nil.
+func (s *Store) Set(k string, v interface{}) error {
+	return s.SetEx(k, v, 0)
+}
+
+// SetEx store the give value for the given key and the key expire after expires.
+func (s *Store) SetEx(k string, v interface{}, expires time.Duration) error {
+	return s.SetExCtx(context.Background(), k, v, expires)
+}
+
+// SetCtx is like Set, but aborts when ctx is done.
+func (s *Store) SetCtx(ctx context.Context, k string, v interface{}) error {
+	return s.SetExCtx(ctx, k, v, 0)
+}
+
+// SetExCtx is like SetEx, but aborts when ctx is done.
+// The key is written with the dialect's single upsert statement.
+func (s *Store) SetExCtx(ctx context.Context, k string, v interface{}, expires time.Duration) error {
+	if err := s.checkKey(k); err != nil {
+		return err
+	}
+	if err := util.CheckVal(v); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := s.marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.exec(ctx, s.Dialect.Upsert(s.table, s.expiresAt(expires)), k, data)
+	return err
+}
+
+// Get retrieves the stored value for the given key.
+// You need to pass a pointer to the value, so in case of a struct
+// the automatic unmarshalling can populate the fields of the object
+// that v points to with the values of the retrieved object's values.
+// If no value is found it returns (false, nil).
+// The key must not be "" and the pointer must not be nil.
+func (s *Store) Get(k string, v interface{}) (found bool, err error) {
+	return s.GetCtx(context.Background(), k, v)
+}
+
+// GetCtx is like Get, but aborts when ctx is done.
+func (s *Store) GetCtx(ctx context.Context, k string, v interface{}) (found bool, err error) {
+	if err := s.checkKey(k); err != nil {
+		return false, err
+	}
+	if err := util.CheckVal(v); err != nil {
+		return false, err
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	var data []byte
+	found, err = s.scanRow(ctx, "SELECT data FROM "+s.Dialect.Quote(s.table)+" WHERE id = ? AND "+s.notExpired(),
+		[]interface{}{k}, &data)
+	if err != nil || !found {
+		return false, err
+	}
+
+	return true, s.unmarshal(data, v)
+}
+
+// Has judge store has a key for k
+func (s *Store) Has(k string) bool {
+	return s.HasCtx(context.Background(), k)
+}
+
+// HasCtx is like Has, but returns false when ctx is done.
+func (s *Store) HasCtx(ctx context.Context, k string) bool {
+	if s.checkKey(k) != nil || ctx.Err() != nil {
+		return false
+	}
+
+	var one int
+	found, err := s.scanRow(ctx, "SELECT 1 FROM "+s.Dialect.Quote(s.table)+" WHERE id = ? AND "+s.notExpired(),
+		[]interface{}{k}, &one)
+	return err == nil && found
+}
+
+// Delete deletes the stored value for the given key.
+// Deleting a non-existing key-value pair does NOT lead to an error.
+// The key must not be "".
+func (s *Store) Delete(k string) error {
+	return s.DeleteCtx(context.Background(), k)
+}
+
+// DeleteCtx is like Delete, but aborts when ctx is done.
+func (s *Store) DeleteCtx(ctx context.Context, k string) error {
+	if err := s.checkKey(k); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	_, err := s.exec(ctx, "DELETE FROM "+s.Dialect.Quote(s.table)+" WHERE id = ?", k)
+	return err
+}
+
+// Close closes the Store.
+// The auto GC is stopped first, a running pass is aborted after the current batch.
+// The database is not closed, it belongs to the caller.
+// Using the store afterwards results in gokv.ErrClosed.
+func (s *Store) Close() error {
+	s.stopGC()
+	s.closed.Store(true)
+	return nil
+}
+
+// Ping checks that the database can be reached.
+func (s *Store) Ping() error {
+	if err := s.checkOpen(); err != nil {
+		return err
+	}
+	return wrapErr(s.DB.Ping())
+}
+
+// checkOpen returns gokv.ErrClosed if the store was closed.
+func (s *Store) checkOpen() error {
+	if s.closed.Load() {
+		return gokv.ErrClosed
+	}
+	return nil
+}
+
+// checkKey checks that k is a valid key that fits into the id column.
+func (s *Store) checkKey(k string) error {
+	if err := util.CheckKey(k); err != nil {
+		return err
+	}
+	if len(k) > s.keyLength {
+		return fmt.Errorf("sql: key of %d bytes, the maximum is %d: %w", len(k), s.keyLength, gokv.ErrKeyTooLong)
+	}
+	return nil
+}
+
+// exec runs a statement written with "?" placeholders.
+func (s *Store) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if err := s.checkOpen(); err != nil {
+		return nil, err
+	}
+	res, err := s.DB.ExecContext(ctx, s.rebind(query), args...)
+	return res, wrapErr(err)
+}
+
+// scanRow runs a query written with "?" placeholders and scans its first row into dest.
+// It reports whether there was a row.
+func (s *Store) scanRow(ctx context.Context, query string, args []interface{}, dest ...interface{}) (found bool, err error) {
+	if err := s.checkOpen(); err != nil {
+		return false, err
+	}
+	err = s.DB.QueryRowContext(ctx, s.rebind(query), args...).Scan(dest...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, wrapErr(err)
+}
+
+// rebind replaces the "?" placeholders of query with the dialect's placeholders.
+func (s *Store) rebind(query string) string {
+	if s.Dialect.Placeholder(1) == "?" {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString(s.Dialect.Placeholder(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// notExpired returns the condition for rows that aren't expired.
+func (s *Store) notExpired() string {
+	return "(expiresAt IS NULL OR expiresAt > " + s.Dialect.Now() + ")"
+}
+
+// expiresAt returns the expression for the database time after expires, NULL (never expire) for 0.
+func (s *Store) expiresAt(expires time.Duration) string {
+	if expires <= 0 {
+		return "NULL"
+	}
+	return "(" + s.Dialect.Now() + " + " + strconv.FormatInt(expires.Milliseconds(), 10) + ")"
+}
+
+// options are the options for the sql store.
+type Options struct {
+	// DB is the database of the store, it isn't closed by Store.Close.
+	// Required.
+	DB *sql.DB
+	// Dialect of the database.
+	// Required.
+	Dialect Dialect
+	// Codec of the values.
+	// Optional (encoding.JSON by default).
+	Codec encoding.Codec
+	// TableName is the name of the store's table, which is created by NewE if it doesn't exist.
+	// Optional ("gokv" by default).
+	TableName string
+	// KeyLength is the maximum length of a key in bytes, longer keys are rejected with gokv.ErrKeyTooLong.
+	// It is the length of the id column of a new table.
+	// Optional (64 by default).
+	KeyLength int
+	// Interval is the time between two passes of the auto GC.
+	// Optional (30s by default).
+	Interval time.Duration
+	// DisableAutoGC turns off the periodic deletion of expired rows every Interval.
+	// Expired rows are still never returned, and GC can be called manually.
+	// Optional (false by default).
+	DisableAutoGC bool
+	// OnGC is called with the results of every auto GC pass.
+	// Optional (nil by default).
+	OnGC func(gokv.GCStats)
+	// GCBatchSize is the maximum number of rows deleted by a single statement of the GC.
+	// Optional (1000 by default).
+	GCBatchSize int
+	// Logger receives the store's log messages, e.g. the results of the auto GC passes.
+	// Optional (gokv.NopLogger by default).
+	Logger gokv.Logger
+}
+
+var DefaultOptions = Options{
+	Codec:     encoding.JSON,
+	TableName: "gokv",
+	KeyLength: 64,
+	Interval:  30 * time.Second,
+}
+
+// New creates a store on the database of options.
+// It returns nil if the store can't be created, use NewE to get the cause.
+func New(options Options) *Store {
+	s, err := NewE(options)
+	if err != nil {
+		return nil
+	}
+	return s
+}
+
+// NewE is like New, but returns the error that prevented the store from being created.
+// The table of the store is created if it doesn't exist yet.
+func NewE(options Options) (*Store, error) {
+	if options.DB == nil || options.Dialect == nil {
+		return nil, errors.New("sql: DB and Dialect are required")
+	}
+	if options.Codec == nil {
+		options.Codec = DefaultOptions.Codec
+	}
+	if options.TableName == "" {
+		options.TableName = DefaultOptions.TableName
+	}
+	if options.KeyLength <= 0 {
+		options.KeyLength = DefaultOptions.KeyLength
+	}
+	if options.Interval == 0 {
+		options.Interval = DefaultOptions.Interval
+	}
+	if options.GCBatchSize <= 0 {
+		options.GCBatchSize = _defGCBatchSize
+	}
+	if options.Logger == nil {
+		options.Logger = gokv.NopLogger
+	}
+
+	s := &Store{
+		DB:          options.DB,
+		Dialect:     options.Dialect,
+		Codec:       options.Codec,
+		table:       options.TableName,
+		keyLength:   options.KeyLength,
+		gcBatchSize: options.GCBatchSize,
+		logger:      options.Logger,
+	}
+
+	if _, err := s.exec(context.Background(), s.Dialect.CreateTable(s.table, s.keyLength)); err != nil {
+		return nil, fmt.Errorf("sql: can't create table %s: %w", s.table, err)
+	}
+
+	if !options.DisableAutoGC {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.gcCancel = cancel
+		s.gcDone = make(chan struct{})
+		go s.autoGC(ctx, options.Interval, options.OnGC)
+	}
+
+	return s, nil
+}
@@ -0,0 +1,68 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/yifeng01/gokv/util"
+)
+
+// TTL returns the time left until k expires, 0 means that k never expires.
+// The time left is computed by the database in milliseconds.
+func (s *Store) TTL(k string) (ttl time.Duration, found bool, err error) {
+	if err := s.checkKey(k); err != nil {
+		return 0, false, err
+	}
+
+	var millis sql.NullInt64
+	found, err = s.scanRow(context.Background(), "SELECT expiresAt - "+s.Dialect.Now()+" FROM "+s.Dialect.Quote(s.table)+
+		" WHERE id = ? AND "+s.notExpired(), []interface{}{k}, &millis)
+	if err != nil || !found {
+		return 0, false, err
+	}
+	return time.Duration(millis.Int64) * time.Millisecond, true, nil
+}
+
+// Expire sets k to expire after expires, which must be positive.
+// Only the expiresAt column is updated, the stored data is kept as is.
+func (s *Store) Expire(k string, expires time.Duration) (found bool, err error) {
+	if err := util.CheckExpires(expires); err != nil {
+		return false, err
+	}
+	return s.update(k, "expiresAt", s.expiresAt(expires))
+}
+
+// Persist removes the expiry of k, so that it never expires.
+// Only the expiresAt column is updated, the stored data is kept as is.
+func (s *Store) Persist(k string) (found bool, err error) {
+	return s.update(k, "expiresAt", "NULL")
+}
+
+// Touch sets the ctime column of k to the database time.
+func (s *Store) Touch(k string) (found bool, err error) {
+	return s.update(k, "ctime", s.Dialect.Now())
+}
+
+// update sets column of the unexpired row of k to the SQL expression expr.
+func (s *Store) update(k, column, expr string) (found bool, err error) {
+	if err := s.checkKey(k); err != nil {
+		return false, err
+	}
+
+	res, err := s.exec(context.Background(), "UPDATE "+s.Dialect.Quote(s.table)+" SET "+column+" = "+expr+
+		" WHERE id = ? AND "+s.notExpired(), k)
+	if err != nil {
+		return false, err
+	}
+	return affected(res, 1)
+}
+
+// affected reports whether res affected n rows.
+func affected(res sql.Result, n int64) (bool, error) {
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, wrapErr(err)
+	}
+	return rows == n, nil
+}
@@ -0,0 +1,100 @@
+package syncmap
+
+import (
+	"time"
+
+	"github.com/yifeng01/gokv/util"
+)
+
+// SetMulti stores all key-value pairs of m.
+// All values are marshalled before the first one is stored,
+// so a marshalling error leaves the store untouched.
+// Every key expires after expires, 0 means never expire.
+// No key may be "" and no value may be nil.
+func (s *Store) SetMulti(m map[string]interface{}, expires time.Duration) error {
+	items := make(map[string]*Item, len(m))
+	for k, v := range m {
+		if err := util.CheckKeyAndValue(k, v); err != nil {
+			return err
+		}
+		data, err := s.marshal(v)
+		if err != nil {
+			return err
+		}
+		items[k] = newItem(data, expires)
+	}
+
+	if err := s.checkOpen(); err != nil {
+		return err
+	}
+	for k, item := range items {
+		s.m.Store(k, item)
+	}
+	return nil
+}
+
+// GetMulti retrieves the values for the given keys.
+// Expired values are reported as not found and deleted.
+// newValue must return a pointer that a found value is unmarshalled into.
+// The returned map only contains the keys that were found.
+func (s *Store) GetMulti(keys []string, newValue func() interface{}) (map[string]interface{}, error) {
+	for _, k := range keys {
+		if err := util.CheckKey(k); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make(map[string]interface{}, len(keys))
+	for _, k := range keys {
+		item, found, err := s.load(k)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+		v := newValue()
+		if err := s.unmarshal(item.Data, v); err != nil {
+			return nil, err
+		}
+		result[k] = v
+	}
+	return result, nil
+}
+
+// HasMulti reports for each of the given keys whether an unexpired value is stored for it.
+func (s *Store) HasMulti(keys []string) (map[string]bool, error) {
+	for _, k := range keys {
+		if err := util.CheckKey(k); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		_, found, err := s.load(k)
+		if err != nil {
+			return nil, err
+		}
+		result[k] = found
+	}
+	return result, nil
+}
+
+// DeleteMulti deletes the stored values for the given keys.
+// Deleting non-existing key-value pairs does NOT lead to an error.
+func (s *Store) DeleteMulti(keys []string) error {
+	for _, k := range keys {
+		if err := util.CheckKey(k); err != nil {
+			return err
+		}
+	}
+
+	if err := s.checkOpen(); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		s.m.Delete(k)
+	}
+	return nil
+}
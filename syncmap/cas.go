@@ -0,0 +1,84 @@
+package syncmap
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/yifeng01/gokv/util"
+)
+
+// SetNX stores v for k only if k doesn't exist or is expired.
+// It uses LoadOrStore, and replaces an expired item with CompareAndSwap.
+// It reports whether v was stored.
+func (s *Store) SetNX(k string, v interface{}, expires time.Duration) (stored bool, err error) {
+	if err := util.CheckKeyAndValue(k, v); err != nil {
+		return false, err
+	}
+
+	data, err := s.marshal(v)
+	if err != nil {
+		return false, err
+	}
+	item := newItem(data, expires)
+	if err := s.checkOpen(); err != nil {
+		return false, err
+	}
+
+	for {
+		dataInterface, loaded := s.m.LoadOrStore(k, item)
+		if !loaded {
+			return true, nil
+		}
+		current := dataInterface.(*Item)
+		if !current.IsExpired() {
+			return false, nil
+		}
+		if s.m.CompareAndSwap(k, current, item) {
+			return true, nil
+		}
+		// Another writer got in between, try again.
+	}
+}
+
+// CompareAndSwap stores new for k only if the stored value of k encodes to the same bytes as old.
+// The swap is retried until no concurrent write got in between.
+// The expiry of k is kept.
+// It reports whether new was stored.
+func (s *Store) CompareAndSwap(k string, old, new interface{}) (swapped bool, err error) {
+	if err := util.CheckKeyAndValue(k, old); err != nil {
+		return false, err
+	}
+	if err := util.CheckVal(new); err != nil {
+		return false, err
+	}
+
+	oldData, err := s.marshal(old)
+	if err != nil {
+		return false, err
+	}
+	newData, err := s.marshal(new)
+	if err != nil {
+		return false, err
+	}
+	if err := s.checkOpen(); err != nil {
+		return false, err
+	}
+
+	for {
+		dataInterface, found := s.m.Load(k)
+		if !found {
+			return false, nil
+		}
+		current := dataInterface.(*Item)
+		if current.IsExpired() || !bytes.Equal(current.Data, oldData) {
+			return false, nil
+		}
+		item := &Item{
+			ExpiresAt: current.ExpiresAt,
+			Data:      util.CopyData(newData),
+		}
+		if s.m.CompareAndSwap(k, current, item) {
+			return true, nil
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package syncmap
+
+import (
+	"time"
+
+	"github.com/yifeng01/gokv/util"
+)
+
+// Incr adds delta to the integer stored for k and returns the new value.
+// The new item is stored with CompareAndSwap, which is retried until no concurrent write got in between.
+// A missing or expired k starts at 0.
+// If ttl > 0 the expiry of k is set to ttl, otherwise the current expiry is kept.
+func (s *Store) Incr(k string, delta int64, ttl time.Duration) (int64, error) {
+	if err := util.CheckKey(k); err != nil {
+		return 0, err
+	}
+	if err := s.checkOpen(); err != nil {
+		return 0, err
+	}
+
+	for {
+		var n int64
+		var expiresAt time.Time
+		dataInterface, found := s.m.Load(k)
+		if found {
+			if current := dataInterface.(*Item); !current.IsExpired() {
+				if err := s.unmarshal(current.Data, &n); err != nil {
+					return 0, err
+				}
+				expiresAt = current.ExpiresAt
+			}
+		}
+		n += delta
+		if ttl > 0 {
+			expiresAt = time.Now().Add(ttl)
+		}
+
+		data, err := s.marshal(n)
+		if err != nil {
+			return 0, err
+		}
+		item := &Item{
+			ExpiresAt: expiresAt,
+			Data:      util.CopyData(data),
+		}
+
+		if found {
+			if s.m.CompareAndSwap(k, dataInterface, item) {
+				return n, nil
+			}
+		} else if _, loaded := s.m.LoadOrStore(k, item); !loaded {
+			return n, nil
+		}
+		// Another writer got in between, try again.
+	}
+}
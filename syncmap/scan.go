@@ -0,0 +1,67 @@
+package syncmap
+
+import (
+	"strings"
+
+	"github.com/yifeng01/gokv"
+	"github.com/yifeng01/gokv/util"
+)
+
+// Keys returns the next page of keys that start with prefix, in lexical order.
+// Pass "" as cursor to start; an empty next cursor means the iteration is complete.
+// Expired entries are skipped.
+func (s *Store) Keys(prefix, cursor string, count int) (keys []string, next string, err error) {
+	items, err := s.liveItems(prefix)
+	if err != nil {
+		return nil, "", err
+	}
+	keys = make([]string, 0, len(items))
+	for k := range items {
+		keys = append(keys, k)
+	}
+
+	keys, next = util.PageKeys(keys, cursor, count)
+	return keys, next, nil
+}
+
+// Entries returns the next page of key-value pairs whose keys start with prefix, in lexical key order.
+// newValue must return a pointer that a value is unmarshalled into.
+// Expired entries are skipped.
+func (s *Store) Entries(prefix, cursor string, count int, newValue func() interface{}) (entries []gokv.KeyValue, next string, err error) {
+	items, err := s.liveItems(prefix)
+	if err != nil {
+		return nil, "", err
+	}
+	keys := make([]string, 0, len(items))
+	for k := range items {
+		keys = append(keys, k)
+	}
+
+	keys, next = util.PageKeys(keys, cursor, count)
+	entries = make([]gokv.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		v := newValue()
+		if err := s.unmarshal(items[k].Data, v); err != nil {
+			return nil, "", err
+		}
+		entries = append(entries, gokv.KeyValue{Key: k, Value: v})
+	}
+	return entries, next, nil
+}
+
+// liveItems returns the unexpired items whose keys start with prefix.
+func (s *Store) liveItems(prefix string) (map[string]*Item, error) {
+	if err := s.checkOpen(); err != nil {
+		return nil, err
+	}
+	items := make(map[string]*Item)
+	s.m.Range(func(k, v interface{}) bool {
+		key := k.(string)
+		item := v.(*Item)
+		if strings.HasPrefix(key, prefix) && !item.IsExpired() {
+			items[key] = item
+		}
+		return true
+	})
+	return items, nil
+}
@@ -1,17 +1,26 @@
 package syncmap
 
 import (
+	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/yifeng01/gokv"
 	"github.com/yifeng01/gokv/encoding"
 	"github.com/yifeng01/gokv/util"
 )
 
 // Store is a gokv.Store implementation for a Go sync.Map.
 type Store struct {
-	m     *sync.Map
-	codec encoding.Codec
+	m      *sync.Map
+	codec  encoding.Codec
+	logger gokv.Logger
+	closed atomic.Bool
+	// For stopping the auto GC, nil if it's disabled.
+	gcStop chan struct{}
+	gcDone chan struct{}
+	gcOnce *sync.Once
 }
 
 // Set stores the given value for the given key.
@@ -23,25 +32,32 @@ func (s *Store) Set(k string, v interface{}) error {
 
 // SetEx store the give value for the given key and the key expire after expires.
 func (s *Store) SetEx(k string, v interface{}, expires time.Duration) error {
+	return s.SetExCtx(context.Background(), k, v, expires)
+}
+
+// SetCtx is like Set, but aborts when ctx is done.
+func (s *Store) SetCtx(ctx context.Context, k string, v interface{}) error {
+	return s.SetExCtx(ctx, k, v, 0)
+}
+
+// SetExCtx is like SetEx, but aborts when ctx is done.
+func (s *Store) SetExCtx(ctx context.Context, k string, v interface{}, expires time.Duration) error {
 	if err := util.CheckKeyAndValue(k, v); err != nil {
 		return err
 	}
 
-	data, err := s.codec.Marshal(v)
+	data, err := s.marshal(v)
 	if err != nil {
 		return err
 	}
 
-	var item *Item
-	if expires == 0 {
-		item = &Item{
-			Data: util.CopyData(data),
-		}
-	} else {
-		item = &Item{
-			ExpiresAt: time.Now().Add(expires),
-			Data:      util.CopyData(data),
-		}
+	item := newItem(data, expires)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.checkOpen(); err != nil {
+		return err
 	}
 
 	s.m.Store(k, item)
@@ -49,34 +65,48 @@ func (s *Store) SetEx(k string, v interface{}, expires time.Duration) error {
 }
 
 // Get retrieves the stored value for the given key.
+// Expired values are reported as not found.
 // You need to pass a pointer to the value, so in case of a struct
 // the automatic unmarshalling can populate the fields of the object
 // that v points to with the values of the retrieved object's values.
 // If no value is found it returns (false, nil).
 // The key must not be "" and the pointer must not be nil.
 func (s *Store) Get(k string, v interface{}) (found bool, err error) {
+	return s.GetCtx(context.Background(), k, v)
+}
+
+// GetCtx is like Get, but aborts when ctx is done.
+func (s *Store) GetCtx(ctx context.Context, k string, v interface{}) (found bool, err error) {
 	if err := util.CheckKeyAndValue(k, v); err != nil {
 		return false, err
 	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
 
-	dataInterface, found := s.m.Load(k)
-	if !found {
-		return false, nil
+	data, found, err := s.load(k)
+	if err != nil || !found {
+		return false, err
 	}
-	// No need to check "ok" return value in type assertion,
-	// because we control the map and we only put slices of bytes in the map.
-	data := dataInterface.(*Item)
 
-	return true, s.codec.Unmarshal(data.Data, v)
+	return true, s.unmarshal(data.Data, v)
 }
 
-// Has judge store has a key for k
+// Has judge store has a key for k that isn't expired
 func (s *Store) Has(k string) bool {
+	return s.HasCtx(context.Background(), k)
+}
+
+// HasCtx is like Has, but returns false when ctx is done.
+func (s *Store) HasCtx(ctx context.Context, k string) bool {
 	if err := util.CheckKey(k); err != nil {
 		return false
 	}
+	if ctx.Err() != nil {
+		return false
+	}
 
-	_, found := s.m.Load(k)
+	_, found, _ := s.load(k)
 
 	return found
 }
@@ -85,35 +115,106 @@ func (s *Store) Has(k string) bool {
 // Deleting a non-existing key-value pair does NOT lead to an error.
 // The key must not be "".
 func (s *Store) Delete(k string) error {
+	return s.DeleteCtx(context.Background(), k)
+}
+
+// DeleteCtx is like Delete, but aborts when ctx is done.
+func (s *Store) DeleteCtx(ctx context.Context, k string) error {
 	if err := util.CheckKey(k); err != nil {
 		return err
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.checkOpen(); err != nil {
+		return err
+	}
 
 	s.m.Delete(k)
 	return nil
 }
 
+// load returns the unexpired item of k.
+// An expired item is deleted right away instead of waiting for the next GC.
+func (s *Store) load(k string) (*Item, bool, error) {
+	if err := s.checkOpen(); err != nil {
+		return nil, false, err
+	}
+	dataInterface, found := s.m.Load(k)
+	if !found {
+		return nil, false, nil
+	}
+	// No need to check "ok" return value in type assertion,
+	// because we control the map and we only put items in the map.
+	item := dataInterface.(*Item)
+	if item.IsExpired() {
+		// Only delete the item if it wasn't replaced in the meantime.
+		s.m.CompareAndDelete(k, item)
+		return nil, false, nil
+	}
+	return item, true, nil
+}
+
 // Close closes the store.
-// When called, the store's pointer to the internal Go map is set to nil,
-// leading to the map being free for garbage collection.
+// When called, all items are removed from the internal Go map,
+// leaving them free for garbage collection.
+// The auto GC is stopped first, a running pass is waited for.
+// Using the store afterwards results in gokv.ErrClosed.
 func (s *Store) Close() error {
-	s.m = nil
+	s.stopGC()
+
+	s.closed.Store(true)
+	s.m.Range(func(k, _ interface{}) bool {
+		s.m.Delete(k)
+		return true
+	})
 	return nil
 }
 
+// checkOpen returns gokv.ErrClosed if the store was closed.
+func (s *Store) checkOpen() error {
+	if s.closed.Load() {
+		return gokv.ErrClosed
+	}
+	return nil
+}
+
+// marshal encodes v with the store's codec.
+func (s *Store) marshal(v interface{}) ([]byte, error) {
+	data, err := s.codec.Marshal(v)
+	return data, util.WrapError(gokv.ErrCodec, err)
+}
+
+// unmarshal decodes data into v with the store's codec.
+func (s *Store) unmarshal(data []byte, v interface{}) error {
+	return util.WrapError(gokv.ErrCodec, s.codec.Unmarshal(data, v))
+}
+
 // GC recycle expire items
-func (s *Store) GC() {
+func (s *Store) GC() gokv.GCStats {
+	start := time.Now()
+	if err := s.checkOpen(); err != nil {
+		return gokv.GCStats{Err: err}
+	}
+
+	var stats gokv.GCStats
 	s.m.Range(func(k, v interface{}) bool {
+		stats.Scanned++
 		item, ok := v.(*Item)
-		if ok && item.IsExpired() {
-			s.m.Delete(k)
+		// Only delete the item if it wasn't replaced in the meantime.
+		if ok && item.IsExpired() && s.m.CompareAndDelete(k, item) {
+			stats.Removed++
 		}
 		return true
 	})
+	stats.Duration = time.Since(start)
+	return stats
 }
 
 // auto GC
-func (s *Store) autoGC(interval time.Duration) {
+// It runs until stopGC is called, onGC (if not nil) gets the results of every pass.
+func (s *Store) autoGC(interval time.Duration, onGC func(gokv.GCStats)) {
+	defer close(s.gcDone)
 	if interval == 0 {
 		interval = 30 * time.Second
 	}
@@ -122,9 +223,28 @@ func (s *Store) autoGC(interval time.Duration) {
 	defer tk.Stop()
 
 	for {
-		<-tk.C
-		s.GC()
+		select {
+		case <-s.gcStop:
+			return
+		case <-tk.C:
+			stats := s.GC()
+			util.LogGC(s.logger, "syncmap", stats)
+			if onGC != nil {
+				onGC(stats)
+			}
+		}
+	}
+}
+
+// stopGC stops the auto GC and waits until it has returned.
+func (s *Store) stopGC() {
+	if s.gcStop == nil {
+		return
 	}
+	s.gcOnce.Do(func() {
+		close(s.gcStop)
+	})
+	<-s.gcDone
 }
 
 // Options are the options for the Go sync.Map store.
@@ -133,6 +253,16 @@ type Options struct {
 	// Optional (encoding.JSON by default).
 	Codec    encoding.Codec
 	Interval time.Duration
+	// DisableAutoGC turns off the periodic removal of expired items.
+	// Expired items are still never returned, and GC can be called manually.
+	// Optional (false by default).
+	DisableAutoGC bool
+	// OnGC is called with the results of every auto GC pass.
+	// Optional (nil by default).
+	OnGC func(gokv.GCStats)
+	// Logger receives the store's log messages, e.g. the results of the auto GC passes.
+	// Optional (gokv.NopLogger by default).
+	Logger gokv.Logger
 }
 
 // DefaultOptions is an Options object with default values.
@@ -150,15 +280,36 @@ func New(options Options) *Store {
 	if options.Codec == nil {
 		options.Codec = DefaultOptions.Codec
 	}
+	if options.Logger == nil {
+		options.Logger = gokv.NopLogger
+	}
+
+	s := &Store{
+		m:      &sync.Map{},
+		codec:  options.Codec,
+		logger: options.Logger,
+	}
 
-	s := Store{
-		m:     &sync.Map{},
-		codec: options.Codec,
+	if !options.DisableAutoGC {
+		s.gcStop = make(chan struct{})
+		s.gcDone = make(chan struct{})
+		s.gcOnce = new(sync.Once)
+		go s.autoGC(options.Interval, options.OnGC)
 	}
 
-	go s.autoGC(options.Interval)
+	return s
+}
 
-	return &s
+// newItem creates an item holding a copy of data,
+// expiring after expires (0 means never expire).
+func newItem(data []byte, expires time.Duration) *Item {
+	item := &Item{
+		Data: util.CopyData(data),
+	}
+	if expires != 0 {
+		item.ExpiresAt = time.Now().Add(expires)
+	}
+	return item
 }
 
 //Item identifes a cached piece of data
@@ -176,3 +327,11 @@ func (i *Item) IsExpired() bool {
 	}
 	return time.Now().After(i.ExpiresAt)
 }
+
+// TTL returns the time left until the item expires, 0 means never expire.
+func (i *Item) TTL() time.Duration {
+	if i.ExpiresAt.IsZero() {
+		return 0
+	}
+	return time.Until(i.ExpiresAt)
+}
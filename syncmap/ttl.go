@@ -0,0 +1,71 @@
+package syncmap
+
+import (
+	"time"
+
+	"github.com/yifeng01/gokv/util"
+)
+
+// TTL returns the time left until k expires, 0 means that k never expires.
+func (s *Store) TTL(k string) (ttl time.Duration, found bool, err error) {
+	if err := util.CheckKey(k); err != nil {
+		return 0, false, err
+	}
+
+	item, found, err := s.load(k)
+	if err != nil || !found {
+		return 0, false, err
+	}
+
+	return item.TTL(), true, nil
+}
+
+// Expire sets k to expire after expires, which must be positive.
+// Only the item's expiry is changed, the stored value is kept as is.
+func (s *Store) Expire(k string, expires time.Duration) (found bool, err error) {
+	if err := util.CheckExpires(expires); err != nil {
+		return false, err
+	}
+	return s.setExpiresAt(k, time.Now().Add(expires))
+}
+
+// Persist removes the expiry of k, so that it never expires.
+func (s *Store) Persist(k string) (found bool, err error) {
+	return s.setExpiresAt(k, time.Time{})
+}
+
+// Touch reports whether k exists.
+// The sync.Map store doesn't track access times, so nothing else is changed.
+func (s *Store) Touch(k string) (found bool, err error) {
+	_, found, err = s.TTL(k)
+	return found, err
+}
+
+// setExpiresAt replaces the item of k by a copy with the given expiry.
+// The swap is retried until no concurrent write got in between.
+func (s *Store) setExpiresAt(k string, expiresAt time.Time) (found bool, err error) {
+	if err := util.CheckKey(k); err != nil {
+		return false, err
+	}
+	if err := s.checkOpen(); err != nil {
+		return false, err
+	}
+
+	for {
+		dataInterface, found := s.m.Load(k)
+		if !found {
+			return false, nil
+		}
+		item := dataInterface.(*Item)
+		if item.IsExpired() {
+			return false, nil
+		}
+		updated := &Item{
+			ExpiresAt: expiresAt,
+			Data:      item.Data,
+		}
+		if s.m.CompareAndSwap(k, item, updated) {
+			return true, nil
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package gokv
+
+import "time"
+
+// Expirer is implemented by stores that can inspect and change the expiry of stored keys.
+// Keys that don't exist or are already expired are reported as not found.
+type Expirer interface {
+	// TTL returns the time left until k expires.
+	// A duration of 0 means that k never expires.
+	TTL(k string) (ttl time.Duration, found bool, err error)
+	// Expire sets k to expire after expires, which must be positive.
+	Expire(k string, expires time.Duration) (found bool, err error)
+	// Persist removes the expiry of k, so that it never expires.
+	Persist(k string) (found bool, err error)
+	// Touch marks k as accessed without changing its value or expiry.
+	// Stores that keep an access or modification time update it,
+	// the others only report whether k exists.
+	Touch(k string) (found bool, err error)
+}
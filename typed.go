@@ -0,0 +1,56 @@
+package gokv
+
+import "time"
+
+// TypedStore wraps a Storer that holds values of a single type T.
+// Values are passed and returned as T instead of interface{},
+// so a mismatch between the stored and the requested type is caught at compile time.
+type TypedStore[T any] struct {
+	s Storer
+}
+
+// NewTypedStore creates a TypedStore for values of type T on top of s.
+func NewTypedStore[T any](s Storer) *TypedStore[T] {
+	return &TypedStore[T]{s: s}
+}
+
+// Set stores v for k.
+func (t *TypedStore[T]) Set(k string, v T) error {
+	return t.s.Set(k, v)
+}
+
+// SetEx stores v for k, k expires after expires.
+func (t *TypedStore[T]) SetEx(k string, v T, expires time.Duration) error {
+	return t.s.SetEx(k, v, expires)
+}
+
+// Get retrieves the value for k.
+// If no value is found it returns the zero value of T and found is false.
+func (t *TypedStore[T]) Get(k string) (v T, found bool, err error) {
+	found, err = t.s.Get(k, &v)
+	if err != nil || !found {
+		var zero T
+		return zero, found, err
+	}
+	return v, true, nil
+}
+
+// Has judge store has a key for k.
+func (t *TypedStore[T]) Has(k string) bool {
+	return t.s.Has(k)
+}
+
+// Delete deletes the stored value for k.
+func (t *TypedStore[T]) Delete(k string) error {
+	return t.s.Delete(k)
+}
+
+// Close closes the underlying store.
+func (t *TypedStore[T]) Close() error {
+	return t.s.Close()
+}
+
+// Store returns the underlying store.
+func (t *TypedStore[T]) Store() Storer {
+	return t.s
+}
@@ -1,8 +1,12 @@
 package util
 
 import (
+	"context"
 	"errors"
+	"sort"
 	"time"
+
+	"github.com/yifeng01/gokv"
 )
 
 // CheckKeyAndValue returns an error if k == "" or if v == nil
@@ -16,7 +20,7 @@ func CheckKeyAndValue(k string, v interface{}) error {
 // CheckKey returns an error if k == ""
 func CheckKey(k string) error {
 	if k == "" {
-		return errors.New("The passed key is an empty string, which is invalid")
+		return gokv.ErrEmptyKey
 	}
 	return nil
 }
@@ -24,11 +28,36 @@ func CheckKey(k string) error {
 // CheckVal returns an error if v == nil
 func CheckVal(v interface{}) error {
 	if v == nil {
-		return errors.New("The passed value is nil, which is not allowed")
+		return gokv.ErrNilValue
+	}
+	return nil
+}
+
+// CheckExpires returns an error if expires isn't positive
+func CheckExpires(expires time.Duration) error {
+	if expires <= 0 {
+		return gokv.ErrInvalidExpiry
 	}
 	return nil
 }
 
+// WrapError returns err as a *gokv.Error of the given kind.
+// nil, context errors and errors that already carry a gokv sentinel error are returned unchanged.
+func WrapError(kind, err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	for _, sentinel := range []error{
+		gokv.ErrEmptyKey, gokv.ErrKeyTooLong, gokv.ErrNilValue, gokv.ErrInvalidExpiry, gokv.ErrClosed,
+		gokv.ErrCodec, gokv.ErrBackendUnavailable, gokv.ErrBackend,
+	} {
+		if errors.Is(err, sentinel) {
+			return err
+		}
+	}
+	return &gokv.Error{Kind: kind, Err: err}
+}
+
 //deepcopy slice
 func CopyData(data []byte) []byte {
 	result := make([]byte, len(data))
@@ -47,3 +76,38 @@ func GetCurDay() string {
 	tmNow := time.Now()
 	return tmNow.Format(_defaultTimeFormat)
 }
+
+// DefaultScanCount is the page size used by scans when the caller doesn't specify one.
+const DefaultScanCount = 100
+
+// PageKeys returns the page of at most count keys that sort after cursor,
+// and the cursor for the following page ("" if there is none).
+// keys is sorted in place.
+func PageKeys(keys []string, cursor string, count int) (page []string, next string) {
+	if count <= 0 {
+		count = DefaultScanCount
+	}
+
+	sort.Strings(keys)
+	start := sort.SearchStrings(keys, cursor)
+	if start < len(keys) && keys[start] == cursor {
+		start++
+	}
+
+	page = keys[start:]
+	if len(page) > count {
+		page = page[:count]
+		next = page[count-1]
+	}
+	return page, next
+}
+
+// LogGC logs the results of an auto GC pass of store,
+// at LevelError if the pass failed and at LevelDebug otherwise.
+func LogGC(logger gokv.Logger, store string, stats gokv.GCStats) {
+	if stats.Err != nil {
+		logger.Log(gokv.LevelError, store+": gc pass failed", "removed", stats.Removed, "err", stats.Err)
+		return
+	}
+	logger.Log(gokv.LevelDebug, store+": gc pass", "scanned", stats.Scanned, "removed", stats.Removed, "duration", stats.Duration)
+}